@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"reflect"
+)
+
+//IContextStore has the same operations as IStore but each takes a context
+//as first argument so that callers control deadlines and cancellation and
+//can pass request values to the backend.
+//Backends implement IContextStore and use Adapt() to also provide IStore.
+type IContextStore interface {
+	Name() string
+	Type() reflect.Type
+
+	Add(ctx context.Context, v interface{}) (info ItemInfo, err error)
+	Get(ctx context.Context, id ID) (v interface{}, info ItemInfo, err error)
+	GetInfo(ctx context.Context, id ID) (info ItemInfo, err error)
+	GetBy(ctx context.Context, max int, key map[string]interface{}) (items []interface{}, info []ItemInfo, err error)
+	Find(ctx context.Context, max int, filter Filter) (items []interface{}, info []ItemInfo, err error)
+	Query(ctx context.Context, q Query) (page Page, err error)
+	Scan(ctx context.Context, filter Filter) (it IIterator, err error)
+	Watch(ctx context.Context, filter Filter, resume string) (w IWatcher, err error)
+	Count(ctx context.Context, filter Filter) (n int, err error)
+	Exists(ctx context.Context, id ID) (exists bool, err error)
+	Upd(ctx context.Context, id ID, v interface{}) (info ItemInfo, err error)
+	UpdIf(ctx context.Context, id ID, expectedRev int, v interface{}) (info ItemInfo, err error)
+	AddMany(ctx context.Context, values []interface{}) (info []ItemInfo, err error)
+	GetMany(ctx context.Context, ids []ID) (items []interface{}, info []ItemInfo, err error)
+	UpdMany(ctx context.Context, ids []ID, values []interface{}) (info []ItemInfo, err error)
+	DelMany(ctx context.Context, ids []ID) error
+	GetRev(ctx context.Context, id ID, rev int) (v interface{}, info ItemInfo, err error)
+	ListRevs(ctx context.Context, id ID) (info []ItemInfo, err error)
+	GetHistory(ctx context.Context, id ID) (items []interface{}, info []ItemInfo, err error)
+	Del(ctx context.Context, id ID) error
+	Undelete(ctx context.Context, id ID) (ItemInfo, error)
+	Purge(ctx context.Context, id ID) error
+	Compact(ctx context.Context) (int, error)
+}
+
+//Adapt makes an IStore that calls the context store with context.Background(),
+//leaving it to the backend to apply its default operation timeout
+func Adapt(s IContextStore) IStore {
+	return adapter{s: s}
+}
+
+type adapter struct {
+	s    IContextStore
+	user ID
+}
+
+//ctx is the context for each operation, with the user set by AsUser()
+func (a adapter) ctx() context.Context {
+	if len(a.user) == 0 {
+		return context.Background()
+	}
+	return WithUser(context.Background(), a.user)
+}
+
+func (a adapter) ContextStore() IContextStore {
+	return a.s
+}
+
+func (a adapter) Name() string {
+	return a.s.Name()
+}
+
+func (a adapter) Type() reflect.Type {
+	return a.s.Type()
+}
+
+func (a adapter) Add(v interface{}) (ItemInfo, error) {
+	return a.s.Add(a.ctx(), v)
+}
+
+func (a adapter) Get(id ID) (interface{}, ItemInfo, error) {
+	return a.s.Get(a.ctx(), id)
+}
+
+func (a adapter) GetInfo(id ID) (ItemInfo, error) {
+	return a.s.GetInfo(a.ctx(), id)
+}
+
+func (a adapter) GetBy(max int, key map[string]interface{}) ([]interface{}, []ItemInfo, error) {
+	return a.s.GetBy(a.ctx(), max, key)
+}
+
+func (a adapter) Find(max int, filter Filter) ([]interface{}, []ItemInfo, error) {
+	return a.s.Find(a.ctx(), max, filter)
+}
+
+func (a adapter) Query(q Query) (Page, error) {
+	return a.s.Query(a.ctx(), q)
+}
+
+func (a adapter) Scan(filter Filter) (IIterator, error) {
+	return a.s.Scan(a.ctx(), filter)
+}
+
+func (a adapter) Watch(filter Filter, resume string) (IWatcher, error) {
+	return a.s.Watch(a.ctx(), filter, resume)
+}
+
+func (a adapter) Count(filter Filter) (int, error) {
+	return a.s.Count(a.ctx(), filter)
+}
+
+func (a adapter) Exists(id ID) (bool, error) {
+	return a.s.Exists(a.ctx(), id)
+}
+
+func (a adapter) Upd(id ID, v interface{}) (ItemInfo, error) {
+	return a.s.Upd(a.ctx(), id, v)
+}
+
+func (a adapter) UpdIf(id ID, expectedRev int, v interface{}) (ItemInfo, error) {
+	return a.s.UpdIf(a.ctx(), id, expectedRev, v)
+}
+
+func (a adapter) AddMany(values []interface{}) ([]ItemInfo, error) {
+	return a.s.AddMany(a.ctx(), values)
+}
+
+func (a adapter) GetMany(ids []ID) ([]interface{}, []ItemInfo, error) {
+	return a.s.GetMany(a.ctx(), ids)
+}
+
+func (a adapter) UpdMany(ids []ID, values []interface{}) ([]ItemInfo, error) {
+	return a.s.UpdMany(a.ctx(), ids, values)
+}
+
+func (a adapter) DelMany(ids []ID) error {
+	return a.s.DelMany(a.ctx(), ids)
+}
+
+func (a adapter) GetRev(id ID, rev int) (interface{}, ItemInfo, error) {
+	return a.s.GetRev(a.ctx(), id, rev)
+}
+
+func (a adapter) ListRevs(id ID) ([]ItemInfo, error) {
+	return a.s.ListRevs(a.ctx(), id)
+}
+
+func (a adapter) GetHistory(id ID) ([]interface{}, []ItemInfo, error) {
+	return a.s.GetHistory(a.ctx(), id)
+}
+
+func (a adapter) Del(id ID) error {
+	return a.s.Del(a.ctx(), id)
+}
+
+func (a adapter) Undelete(id ID) (ItemInfo, error) {
+	return a.s.Undelete(a.ctx(), id)
+}
+
+func (a adapter) Purge(id ID) error {
+	return a.s.Purge(a.ctx(), id)
+}
+
+func (a adapter) Compact() (int, error) {
+	return a.s.Compact(a.ctx())
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//Errors matched with errors.Is() on errors returned by any backend
+var (
+	//ErrNotFound when the item or revision does not exist
+	ErrNotFound = errors.New("not found")
+	//ErrConflict when an update failed because the item was updated after the caller read it
+	ErrConflict = errors.New("revision conflict")
+	//ErrDuplicate when a write would create a duplicate item, see DuplicateError
+	ErrDuplicate = errors.New("duplicate")
+	//ErrInvalidType when a type or value cannot be stored
+	ErrInvalidType = errors.New("invalid type")
+	//ErrInvalidValue when a value fails validation, see ValidationError
+	ErrInvalidValue = errors.New("invalid value")
+	//ErrUnavailable when the backend cannot be reached
+	ErrUnavailable = errors.New("backend unavailable")
+	//ErrInvalidFilter when a filter cannot be applied to the store type
+	ErrInvalidFilter = errors.New("invalid filter")
+	//ErrExpired when a watch cannot resume because the resume token is too old or invalid
+	ErrExpired = errors.New("resume token expired")
+)
+
+//Error is returned by store operations to describe which operation
+//failed on which item. Err is one of the Err... values above, a more
+//specific error that matches one of them, such as ConflictError, or
+//a context error. Cause is the underlying backend error, if any.
+//errors.Is() and errors.As() match both Err and Cause.
+type Error struct {
+	Store string
+	Op    string
+	ID    ID
+	Err   error
+	Cause error
+}
+
+func (e *Error) Error() string {
+	s := strings.Builder{}
+	s.WriteString(e.Store)
+	s.WriteString(".")
+	s.WriteString(e.Op)
+	if len(e.ID) > 0 {
+		fmt.Fprintf(&s, "(id=%s)", e.ID)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&s, ": %v", e.Err)
+	}
+	if e.Cause != nil {
+		fmt.Fprintf(&s, ": %v", e.Cause)
+	}
+	return s.String()
+}
+
+//Unwrap returns Err
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//Is matches target against the cause, while Unwrap() matches Err
+func (e *Error) Is(target error) bool {
+	return e.Cause != nil && errors.Is(e.Cause, target)
+}
+
+//As matches target against the cause, while Unwrap() matches Err
+func (e *Error) As(target interface{}) bool {
+	return e.Cause != nil && errors.As(e.Cause, target)
+}
+
+//ConflictError is the Err in an Error from UpdIf() when the latest
+//revision of the item is not the revision that the caller expected
+type ConflictError struct {
+	ID          ID
+	Rev         int
+	ExpectedRev int
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("id=%s is at rev=%d, expected rev=%d", e.ID, e.Rev, e.ExpectedRev)
+}
+
+//Is makes errors.Is(err, ErrConflict) true
+func (e ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+//DuplicateError is the Err in an Error from a write that would give two
+//items the same values in the fields of a unique index
+type DuplicateError struct {
+	//Index is the name of the unique index, see Indexes()
+	Index string
+	//ID is the item that already has the values, if known
+	ID ID
+}
+
+func (e DuplicateError) Error() string {
+	if len(e.ID) > 0 {
+		return fmt.Sprintf("duplicate in unique index %s of id=%s", e.Index, e.ID)
+	}
+	return fmt.Sprintf("duplicate in unique index %s", e.Index)
+}
+
+//Is makes errors.Is(err, ErrDuplicate) true
+func (e DuplicateError) Is(target error) bool {
+	return target == ErrDuplicate
+}
+
+//TypeError is the Err in an Error from Add() and Upd() when the value is
+//not of the store type or a pointer to it
+type TypeError struct {
+	Type     reflect.Type
+	Expected reflect.Type
+}
+
+func (e TypeError) Error() string {
+	return fmt.Sprintf("value type %v is not store type %v", e.Type, e.Expected)
+}
+
+//Is makes errors.Is(err, ErrInvalidType) true
+func (e TypeError) Is(target error) bool {
+	return target == ErrInvalidType
+}
+
+//BatchError is returned by batch operations when some items failed.
+//Errs has one entry per item in the batch, which is nil for items that succeeded.
+type BatchError struct {
+	Errs []error
+}
+
+func (e *BatchError) Error() string {
+	nrFailed := 0
+	var first error
+	for _, err := range e.Errs {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			nrFailed++
+		}
+	}
+	return fmt.Sprintf("%d of %d failed, first: %v", nrFailed, len(e.Errs), first)
+}
+
+//NewBatchError returns a *BatchError if any of errs is not nil, else nil
+func NewBatchError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errs: errs}
+		}
+	}
+	return nil
+}
+
+//BatchErrors returns the error for each item from a batch operation that
+//returned err for n items, which is the same err for all when err is not a
+//*BatchError, or nil for all when err is nil
+func BatchErrors(err error, n int) []error {
+	if batchErr, ok := err.(*BatchError); ok {
+		return batchErr.Errs
+	}
+	errs := make([]error, n)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
@@ -0,0 +1,418 @@
+package store
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+)
+
+//FilterOp is the operation of a Filter
+type FilterOp string
+
+//Filter operations
+const (
+	OpAll    FilterOp = "" //zero Filter matches all items
+	OpEq     FilterOp = "eq"
+	OpNe     FilterOp = "ne"
+	OpLt     FilterOp = "lt"
+	OpLte    FilterOp = "lte"
+	OpGt     FilterOp = "gt"
+	OpGte    FilterOp = "gte"
+	OpIn     FilterOp = "in"
+	OpPrefix FilterOp = "prefix"
+	OpRegex  FilterOp = "regex"
+	OpExists FilterOp = "exists"
+	OpAnd    FilterOp = "and"
+	OpOr     FilterOp = "or"
+	OpNot    FilterOp = "not"
+)
+
+//Filter selects items on the values of their fields.
+//Field is a dotted path of field names into nested structs, e.g. "Address.City",
+//where names match the Go field name, the bson tag name, or the Go name in any case.
+//When the path reaches a slice, the filter matches if any element matches.
+//Build filters with the functions below, e.g.
+//	And(In("Status", "active", "suspended"), Gt("Created", t))
+type Filter struct {
+	Op      FilterOp
+	Field   string
+	Value   interface{}
+	Filters []Filter
+}
+
+//All matches all items
+func All() Filter { return Filter{} }
+
+//Eq matches items where the field equals value
+func Eq(field string, value interface{}) Filter {
+	return Filter{Op: OpEq, Field: field, Value: value}
+}
+
+//Ne matches items where the field does not equal value
+func Ne(field string, value interface{}) Filter {
+	return Filter{Op: OpNe, Field: field, Value: value}
+}
+
+//Lt matches items where the field is less than value
+func Lt(field string, value interface{}) Filter {
+	return Filter{Op: OpLt, Field: field, Value: value}
+}
+
+//Lte matches items where the field is less than or equal to value
+func Lte(field string, value interface{}) Filter {
+	return Filter{Op: OpLte, Field: field, Value: value}
+}
+
+//Gt matches items where the field is greater than value
+func Gt(field string, value interface{}) Filter {
+	return Filter{Op: OpGt, Field: field, Value: value}
+}
+
+//Gte matches items where the field is greater than or equal to value
+func Gte(field string, value interface{}) Filter {
+	return Filter{Op: OpGte, Field: field, Value: value}
+}
+
+//In matches items where the field equals one of the values
+func In(field string, values ...interface{}) Filter {
+	return Filter{Op: OpIn, Field: field, Value: values}
+}
+
+//Prefix matches items where the string field starts with prefix
+func Prefix(field string, prefix string) Filter {
+	return Filter{Op: OpPrefix, Field: field, Value: prefix}
+}
+
+//Regex matches items where the string field matches the regular expression
+func Regex(field string, expr string) Filter {
+	return Filter{Op: OpRegex, Field: field, Value: expr}
+}
+
+//Exists matches items where the field is set, i.e. not a nil pointer, slice or map
+func Exists(field string) Filter {
+	return Filter{Op: OpExists, Field: field}
+}
+
+//And matches items that match all the filters
+func And(filters ...Filter) Filter {
+	return Filter{Op: OpAnd, Filters: filters}
+}
+
+//Or matches items that match any of the filters
+func Or(filters ...Filter) Filter {
+	return Filter{Op: OpOr, Filters: filters}
+}
+
+//Not matches items that do not match the filter
+func Not(filter Filter) Filter {
+	return Filter{Op: OpNot, Filters: []Filter{filter}}
+}
+
+//KeyFilter makes a filter that matches all fields in key as used by GetBy()
+func KeyFilter(key map[string]interface{}) Filter {
+	filters := make([]Filter, 0, len(key))
+	for field, value := range key {
+		filters = append(filters, Eq(field, value))
+	}
+	return And(filters...)
+}
+
+//Validate checks that the filter can be applied to items of type t
+func (f Filter) Validate(t reflect.Type) error {
+	switch f.Op {
+	case OpAll:
+		return nil
+	case OpAnd, OpOr, OpNot:
+		if f.Op == OpNot && len(f.Filters) != 1 {
+			return errors.Errorf("%s needs one filter", f.Op)
+		}
+		for _, sub := range f.Filters {
+			if err := sub.Validate(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OpEq, OpNe, OpLt, OpLte, OpGt, OpGte, OpExists:
+	case OpIn:
+		if _, ok := f.Value.([]interface{}); !ok {
+			return errors.Errorf("%s(%s) needs []interface{} value", f.Op, f.Field)
+		}
+	case OpPrefix, OpRegex:
+		expr, ok := f.Value.(string)
+		if !ok {
+			return errors.Errorf("%s(%s) needs string value", f.Op, f.Field)
+		}
+		if f.Op == OpRegex {
+			if _, err := regexp.Compile(expr); err != nil {
+				return errors.Wrapf(err, "%s(%s) invalid expression", f.Op, f.Field)
+			}
+		}
+	default:
+		return errors.Errorf("unknown filter op \"%s\"", f.Op)
+	}
+	if _, err := FieldByPath(t, f.Field); err != nil {
+		return err
+	}
+	return nil
+} //Filter.Validate()
+
+//FieldByPath returns the struct fields along a dotted path in struct type t,
+//stepping through pointers and slices to reach nested struct fields
+func FieldByPath(t reflect.Type, path string) ([]reflect.StructField, error) {
+	if len(path) == 0 {
+		return nil, errors.Errorf("missing field name")
+	}
+	fields := make([]reflect.StructField, 0)
+	for _, name := range strings.Split(path, ".") {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, errors.Errorf("field \"%s\" is not in a struct", path)
+		}
+		f, ok := fieldByName(t, name)
+		if !ok {
+			return nil, errors.Errorf("%v has no field \"%s\"", t, name)
+		}
+		fields = append(fields, f)
+		t = f.Type
+	}
+	return fields, nil
+} //FieldByPath()
+
+//fieldByName looks for an exported field matching the Go name, bson tag name
+//or the Go name in any case
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	if f, ok := t.FieldByName(name); ok && len(f.PkgPath) == 0 {
+		return f, true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		tagName := strings.Split(f.Tag.Get("bson"), ",")[0]
+		if tagName == name || (len(tagName) == 0 && strings.EqualFold(f.Name, name)) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+} //fieldByName()
+
+//Match evaluates the filter on an item value using reflection
+//as done by backends that cannot evaluate it natively
+func (f Filter) Match(v interface{}) (bool, error) {
+	return f.match(reflect.ValueOf(v))
+}
+
+func (f Filter) match(v reflect.Value) (bool, error) {
+	switch f.Op {
+	case OpAll:
+		return true, nil
+	case OpAnd:
+		for _, sub := range f.Filters {
+			if ok, err := sub.match(v); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case OpOr:
+		for _, sub := range f.Filters {
+			if ok, err := sub.match(v); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case OpNot:
+		if len(f.Filters) != 1 {
+			return false, errors.Errorf("%s needs one filter", f.Op)
+		}
+		ok, err := f.Filters[0].match(v)
+		return !ok, err
+	case OpNe:
+		ok, err := Eq(f.Field, f.Value).match(v)
+		return !ok, err
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	fields, err := FieldByPath(v.Type(), f.Field)
+	if err != nil {
+		return false, err
+	}
+	for _, fv := range fieldValues(v, fields) {
+		ok, err := f.matchValue(fv)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+} //Filter.match()
+
+//matchValue applies a field operation to one field value
+func (f Filter) matchValue(fv reflect.Value) (bool, error) {
+	if f.Op == OpExists {
+		switch fv.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			return !fv.IsNil(), nil
+		}
+		return true, nil
+	}
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			//nil only equals nil
+			return f.Op == OpEq && f.Value == nil, nil
+		}
+		fv = fv.Elem()
+	}
+	switch f.Op {
+	case OpEq:
+		c, ok := compare(fv, reflect.ValueOf(f.Value))
+		return ok && c == 0, nil
+	case OpLt, OpLte, OpGt, OpGte:
+		c, ok := compare(fv, reflect.ValueOf(f.Value))
+		if !ok {
+			return false, nil
+		}
+		switch f.Op {
+		case OpLt:
+			return c < 0, nil
+		case OpLte:
+			return c <= 0, nil
+		case OpGt:
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case OpIn:
+		values, _ := f.Value.([]interface{})
+		for _, value := range values {
+			if c, ok := compare(fv, reflect.ValueOf(value)); ok && c == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case OpPrefix:
+		prefix, _ := f.Value.(string)
+		return fv.Kind() == reflect.String && strings.HasPrefix(fv.String(), prefix), nil
+	case OpRegex:
+		expr, _ := f.Value.(string)
+		if fv.Kind() != reflect.String {
+			return false, nil
+		}
+		return regexp.MatchString(expr, fv.String())
+	}
+	return false, errors.Errorf("unknown filter op \"%s\"", f.Op)
+} //Filter.matchValue()
+
+//fieldValues returns the values at the end of the field path in v,
+//expanding slices along the way and at the end
+func fieldValues(v reflect.Value, fields []reflect.StructField) []reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if len(fields) == 0 {
+				return []reflect.Value{v}
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 {
+		values := make([]reflect.Value, 0)
+		if len(fields) == 0 {
+			values = append(values, v) //the slice itself, e.g. to test Exists
+		}
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, fieldValues(v.Index(i), fields)...)
+		}
+		return values
+	}
+	if len(fields) == 0 {
+		return []reflect.Value{v}
+	}
+	fv, err := v.FieldByIndexErr(fields[0].Index)
+	if err != nil {
+		return nil //nil embedded struct pointer
+	}
+	return fieldValues(fv, fields[1:])
+} //fieldValues()
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//compare returns -1, 0 or 1 when a is less than, equal to or more than b
+//and false if they cannot be compared. Numbers of any kind are compared by value.
+func compare(a, b reflect.Value) (int, bool) {
+	if !a.IsValid() || !b.IsValid() {
+		return 0, false
+	}
+	switch {
+	case a.Type() == timeType && b.Type() == timeType:
+		ta := a.Interface().(time.Time)
+		tb := b.Interface().(time.Time)
+		switch {
+		case ta.Before(tb):
+			return -1, true
+		case ta.After(tb):
+			return 1, true
+		}
+		return 0, true
+	case isInt(a) && isInt(b):
+		return order(a.Int() < b.Int(), a.Int() > b.Int()), true
+	case isUint(a) && isUint(b):
+		return order(a.Uint() < b.Uint(), a.Uint() > b.Uint()), true
+	case isNumber(a) && isNumber(b):
+		fa, fb := toFloat(a), toFloat(b)
+		return order(fa < fb, fa > fb), true
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String()), true
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		return order(!a.Bool() && b.Bool(), a.Bool() && !b.Bool()), true
+	}
+	if a.Type() == b.Type() && reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return 0, true
+	}
+	return 0, false
+} //compare()
+
+func order(less, more bool) int {
+	switch {
+	case less:
+		return -1
+	case more:
+		return 1
+	}
+	return 0
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUint(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isNumber(v reflect.Value) bool {
+	return isInt(v) || isUint(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case isInt(v):
+		return float64(v.Int())
+	case isUint(v):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
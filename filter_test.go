@@ -0,0 +1,63 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+type address struct {
+	City string
+	Zip  *int
+}
+
+type person struct {
+	Name    string
+	Home    address
+	Work    *address
+	Tags    []string
+	Friends []address
+}
+
+func TestFilterMatch(t *testing.T) {
+	zip := 7100
+	p := person{
+		Name:    "jan",
+		Home:    address{City: "paarl", Zip: &zip},
+		Tags:    []string{"a", "b"},
+		Friends: []address{{City: "worcester"}, {City: "wellington"}},
+	}
+	tests := []struct {
+		filter Filter
+		match  bool
+	}{
+		{All(), true},
+		{Eq("Home.City", "paarl"), true},
+		{Eq("home.city", "paarl"), true},
+		{Eq("Home.Zip", 7100), true},
+		{Gt("Home.Zip", uint8(100)), true},
+		{Exists("Home.Zip"), true},
+		{Exists("Work"), false},
+		{Eq("Work.City", "paarl"), false},
+		{Eq("Tags", "b"), true},
+		{Eq("Tags", "c"), false},
+		{Prefix("Friends.City", "well"), true},
+		{Not(Prefix("Friends.City", "well")), false},
+		{And(Eq("Name", "jan"), In("Friends.City", "x", "worcester")), true},
+		{Or(Eq("Name", "piet"), Regex("Home.City", "^p.*l$")), true},
+	}
+	for _, test := range tests {
+		if err := test.filter.Validate(reflect.TypeOf(person{})); err != nil {
+			t.Fatalf("%+v invalid: %+v", test.filter, err)
+		}
+		match, err := test.filter.Match(p)
+		if err != nil || match != test.match {
+			t.Fatalf("%+v -> %v, err=%v", test.filter, match, err)
+		}
+	}
+
+	for _, f := range []Filter{Eq("Home.Street", "x"), Eq("Name.First", "x"), Regex("Name", "("), {Op: "xx", Field: "Name"}} {
+		if err := f.Validate(reflect.TypeOf(person{})); err == nil {
+			t.Fatalf("%+v is valid", f)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/go-msvc/store
 
-go 1.12
+go 1.18
 
 require (
 	github.com/go-msvc/errors v0.0.0-20191116111408-1c2c4914594f
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+)
+
+//Index is a secondary index declared in the "store" tags of the item type:
+//	index         indexes the field
+//	unique        indexes the field and allows only one item with each value
+//	index=<name>  adds the field to the named compound index
+//	unique=<name> adds the field to the named compound unique index
+//Fields of nested and embedded structs can be indexed, but not fields in lists.
+//Items with a nil pointer on the path to a field, i.e. without the field, are
+//not constrained by a unique index, but a nil field is a value like any other.
+type Index struct {
+	//Name is the name from the tag, or the field path when not named
+	Name string
+	//Fields are the field paths, as used in filters, in the order of the struct fields
+	Fields []string
+	Unique bool
+}
+
+//Indexes returns the indexes declared in the struct type
+func Indexes(t reflect.Type) ([]Index, error) {
+	indexes := []Index{}
+	if err := addIndexes(&indexes, t, "", map[reflect.Type]bool{}); err != nil {
+		return nil, err
+	}
+	return indexes, nil
+} //Indexes()
+
+func addIndexes(indexes *[]Index, t reflect.Type, prefix string, parents map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || parents[t] {
+		return nil
+	}
+	parents[t] = true
+	defer delete(parents, t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		path := prefix + f.Name
+		if f.Anonymous {
+			//promoted fields are named without the embedded struct
+			if err := addIndexes(indexes, f.Type, prefix, parents); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, opt := range tagOptions(f.Tag.Get("store")) {
+			name, value := opt, ""
+			if i := strings.Index(opt, "="); i >= 0 {
+				name, value = opt[:i], opt[i+1:]
+			}
+			if name != "index" && name != "unique" {
+				continue
+			}
+			if k := f.Type.Kind(); (k == reflect.Slice || k == reflect.Array || k == reflect.Map) && f.Type.Elem().Kind() != reflect.Uint8 {
+				return errors.Errorf("%s cannot be indexed because it is a %v", path, k)
+			}
+			if len(value) == 0 {
+				value = path
+			}
+			if err := addIndexField(indexes, value, path, name == "unique"); err != nil {
+				return err
+			}
+		}
+		if err := addIndexes(indexes, f.Type, path+".", parents); err != nil {
+			return err
+		}
+	}
+	return nil
+} //addIndexes()
+
+func addIndexField(indexes *[]Index, name string, path string, unique bool) error {
+	for i, index := range *indexes {
+		if index.Name != name {
+			continue
+		}
+		if index.Unique != unique {
+			return errors.Errorf("index \"%s\" is declared both unique and not unique", name)
+		}
+		for _, field := range index.Fields {
+			if field == path {
+				return errors.Errorf("index \"%s\" has field %s more than once", name, path)
+			}
+		}
+		(*indexes)[i].Fields = append(index.Fields, path)
+		return nil
+	}
+	*indexes = append(*indexes, Index{Name: name, Fields: []string{path}, Unique: unique})
+	return nil
+} //addIndexField()
+
+//Key returns the values of the index fields in v as a string that is equal
+//for equal values, and false when v does not have all the fields
+func (index Index) Key(v interface{}) (string, bool) {
+	rv := reflect.ValueOf(v)
+	key := strings.Builder{}
+	for _, path := range index.Fields {
+		fields, err := FieldByPath(rv.Type(), path)
+		if err != nil {
+			return "", false
+		}
+		values := fieldValues(rv, fields)
+		if len(values) != 1 {
+			return "", false
+		}
+		value := values[0].Interface()
+		if rv := values[0]; (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil() {
+			value = nil
+		}
+		if t, ok := value.(time.Time); ok {
+			value = t.UTC().Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(&key, "%#v;", value)
+	}
+	return key.String(), true
+} //Index.Key()
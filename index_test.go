@@ -0,0 +1,57 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Audit struct {
+	By string `store:"index"`
+}
+
+type Address struct {
+	City string
+}
+
+type indexed struct {
+	Audit
+	Name  string   `store:"unique"`
+	Code  string   `store:"required,index=code,regex=^[a-z,]+$"`
+	Home  *Address `store:"index"`
+	Other Address  `store:"unique=other"`
+	Zone  int      `store:"index=code"`
+}
+
+func TestIndexes(t *testing.T) {
+	indexes, err := Indexes(reflect.TypeOf(indexed{}))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	expected := []Index{
+		{Name: "By", Fields: []string{"By"}},
+		{Name: "Name", Fields: []string{"Name"}, Unique: true},
+		{Name: "code", Fields: []string{"Code", "Zone"}},
+		{Name: "Home", Fields: []string{"Home"}},
+		{Name: "other", Fields: []string{"Other"}, Unique: true},
+	}
+	if !reflect.DeepEqual(indexes, expected) {
+		t.Fatalf("got %+v instead of %+v", indexes, expected)
+	}
+	if key, ok := expected[2].Key(indexed{Code: "a", Zone: 1}); !ok || key != `"a";1;` {
+		t.Fatalf("key=%s,%v", key, ok)
+	}
+
+	for _, v := range []interface{}{
+		struct {
+			A string `store:"index=x"`
+			B string `store:"unique=x"`
+		}{},
+		struct {
+			A []string `store:"unique"`
+		}{},
+	} {
+		if _, err := Indexes(reflect.TypeOf(v)); err == nil {
+			t.Fatalf("invalid indexes in %T did not fail", v)
+		}
+	}
+}
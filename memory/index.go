@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"github.com/go-msvc/store"
+)
+
+//memIndex maps the key of each live item in a unique index to the item id.
+//Other indexes are not kept because the memory store scans all items anyway.
+type memIndex struct {
+	store.Index
+	ids map[string]store.ID
+}
+
+//uniqueIndexes makes the in-memory unique indexes from the declared indexes
+func uniqueIndexes(indexes []store.Index) []memIndex {
+	unique := []memIndex{}
+	for _, index := range indexes {
+		if index.Unique {
+			unique = append(unique, memIndex{Index: index, ids: map[string]store.ID{}})
+		}
+	}
+	return unique
+}
+
+//checkUnique returns a store.DuplicateError if writing v to item id would
+//duplicate another item in a unique index, using id "" for a new item,
+//and must be called while holding the mutex
+func (s *memoryStore) checkUnique(id store.ID, v interface{}) error {
+	for _, index := range s.indexes {
+		if key, ok := index.Key(v); ok {
+			if other, ok := index.ids[key]; ok && other != id {
+				return store.DuplicateError{Index: index.Name, ID: other}
+			}
+		}
+	}
+	return nil
+}
+
+//reindex replaces the keys of item id from old to new data in the unique indexes,
+//where old is nil for an item that was not live and new is nil for an item
+//that is no longer live, and must be called while holding the mutex
+func (s *memoryStore) reindex(id store.ID, old, new interface{}) {
+	for _, index := range s.indexes {
+		if old != nil {
+			if key, ok := index.Key(old); ok && index.ids[key] == id {
+				delete(index.ids, key)
+			}
+		}
+		if new != nil {
+			if key, ok := index.Key(new); ok {
+				index.ids[key] = id
+			}
+		}
+	}
+}
@@ -1,7 +1,17 @@
+//Package memory is a store that keeps all items in memory, e.g. for tests.
+//It enforces the unique indexes declared in store tags, but ignores the other
+//indexes, which only make queries faster in other stores such as mongo, while
+//the memory store always scans all items.
 package memory
 
 import (
+	"context"
+	"net/url"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-msvc/store"
@@ -9,8 +19,37 @@ import (
 	"github.com/satori/uuid"
 )
 
+func init() {
+	store.Register("memory", Config{})
+}
+
 //Config ...
-type Config struct{}
+type Config struct {
+	//SoftDelete makes Del() write a tombstone revision instead of removing the item
+	SoftDelete bool
+	//Retention limits the older revisions kept of each item
+	Retention store.Retention
+}
+
+//FromURL accepts "memory://" with the only option "?softDelete=true"
+func (c Config) FromURL(u *url.URL) (store.IStoreConfig, error) {
+	if len(u.Host) > 0 || len(strings.Trim(u.Path, "/")) > 0 {
+		return nil, errors.Errorf("memory store URL does not take host or path")
+	}
+	for name, values := range u.Query() {
+		switch name {
+		case "softDelete":
+			softDelete, err := strconv.ParseBool(values[0])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid softDelete=%s", values[0])
+			}
+			c.SoftDelete = softDelete
+		default:
+			return nil, errors.Errorf("unknown memory store option \"%s\"", name)
+		}
+	}
+	return c, nil
+}
 
 //New ...
 func (c Config) New(itemName string, itemType reflect.Type) (store.IStore, error) {
@@ -18,19 +57,36 @@ func (c Config) New(itemName string, itemType reflect.Type) (store.IStore, error
 	// 	return nil, errors.Wrapf(err, "invalid config")
 	// }
 	if err := store.ValidateUserType(itemType); err != nil {
-		return nil, errors.Wrapf(err, "cannot store %v", itemType)
+		return nil, &store.Error{Store: itemName, Op: "New", Err: store.ErrInvalidType, Cause: err}
 	}
-	return &memoryStore{
-		itemName: itemName,
-		itemType: itemType,
-		id:       make(map[store.ID][]memItem),
-	}, nil
+	indexes, err := store.Indexes(itemType)
+	if err != nil {
+		return nil, &store.Error{Store: itemName, Op: "New", Err: store.ErrInvalidType, Cause: err}
+	}
+	return store.Adapt(&memoryStore{
+		itemName:   itemName,
+		itemType:   itemType,
+		softDelete: c.SoftDelete,
+		retention:  c.Retention,
+		indexes:    uniqueIndexes(indexes),
+		id:         make(map[store.ID][]memItem),
+		watchers:   make(map[*memWatcher]bool),
+	}), nil
 }
 
+//memoryStore keeps a deep copy of each value written and returns deep copies
+//from reads, so callers cannot change stored values through slices or maps
 type memoryStore struct {
-	itemName string
-	itemType reflect.Type
-	id       map[store.ID][]memItem
+	itemName   string
+	itemType   reflect.Type
+	softDelete bool
+	retention  store.Retention
+	indexes    []memIndex
+	mutex      sync.Mutex
+	id         map[store.ID][]memItem
+	watchers   map[*memWatcher]bool
+	seq        int64
+	changes    []store.Change
 }
 
 type memItem struct {
@@ -38,71 +94,585 @@ type memItem struct {
 	data interface{}
 }
 
-func (s memoryStore) Name() string {
+//error describes a failed operation
+func (s *memoryStore) error(op string, id store.ID, err error, cause error) error {
+	return &store.Error{Store: s.itemName, Op: op, ID: id, Err: err, Cause: cause}
+}
+
+//latest returns the latest revision of an item that is not deleted
+//and must be called while holding the mutex
+func (s *memoryStore) latest(id store.ID) (memItem, bool) {
+	revs, ok := s.id[id]
+	if !ok || revs[len(revs)-1].info.Deleted {
+		return memItem{}, false
+	}
+	return revs[len(revs)-1], true
+}
+
+func (s *memoryStore) Name() string {
 	return s.itemName
 }
 
-func (s memoryStore) Type() reflect.Type {
+func (s *memoryStore) Type() reflect.Type {
 	return s.itemType
 }
 
-func (s *memoryStore) Add(v interface{}) (info store.ItemInfo, err error) {
+func (s *memoryStore) Add(ctx context.Context, v interface{}) (info store.ItemInfo, err error) {
+	if err := ctx.Err(); err != nil {
+		return store.ItemInfo{}, s.error("Add", "", err, nil)
+	}
+	v, err = store.CheckValue(s.itemType, v)
+	if err != nil {
+		return store.ItemInfo{}, s.error("Add", "", err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.checkUnique("", v); err != nil {
+		return store.ItemInfo{}, s.error("Add", "", err, nil)
+	}
+	return s.add(v, store.UserFromContext(ctx)), nil
+}
+
+//add creates a new item written by the user after checkUnique()
+//and must be called while holding the mutex
+func (s *memoryStore) add(v interface{}, user store.ID) store.ItemInfo {
+	v = copyValue(v)
 	newID := store.ID(uuid.NewV1().String())
 	item := memItem{
 		info: store.ItemInfo{
 			ID:        newID,
 			Rev:       1,
 			Timestamp: time.Now(),
-			UserID:    "",
+			UserID:    user,
 		}, data: v}
 
 	s.id[newID] = []memItem{item}
-	return item.info, nil
+	s.reindex(newID, nil, v)
+	s.emit(store.ChangeAdd, item.info, v, nil)
+	return item.info
 }
 
-func (s memoryStore) Get(id store.ID) (interface{}, store.ItemInfo, error) {
-	if revs, ok := s.id[id]; ok {
-		nrRevs := len(revs)
-		lastRev := revs[nrRevs-1]
-		return lastRev.data, lastRev.info, nil
+func (s *memoryStore) Get(ctx context.Context, id store.ID) (interface{}, store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, store.ItemInfo{}, s.error("Get", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if lastRev, ok := s.latest(id); ok {
+		return copyValue(lastRev.data), lastRev.info, nil
 	}
-	return nil, store.ItemInfo{}, errors.Errorf("id=%s not found", id)
+	return nil, store.ItemInfo{}, s.error("Get", id, store.ErrNotFound, nil)
 } //memoryStore.Get()
 
-func (s memoryStore) GetInfo(id store.ID) (info store.ItemInfo, err error) {
-	if revs, ok := s.id[id]; ok {
-		nrRevs := len(revs)
-		lastRev := revs[nrRevs-1]
+func (s *memoryStore) GetInfo(ctx context.Context, id store.ID) (info store.ItemInfo, err error) {
+	if err := ctx.Err(); err != nil {
+		return store.ItemInfo{}, s.error("GetInfo", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if lastRev, ok := s.latest(id); ok {
 		return lastRev.info, nil
 	}
-	return store.ItemInfo{}, errors.Errorf("id=%s not found", id)
+	return store.ItemInfo{}, s.error("GetInfo", id, store.ErrNotFound, nil)
 }
 
-func (s memoryStore) GetBy(max int, key map[string]interface{}) (items []interface{}, info []store.ItemInfo, err error) {
-	return nil, nil, errors.Errorf("NYI")
-}
+func (s *memoryStore) GetRev(ctx context.Context, id store.ID, rev int) (interface{}, store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, store.ItemInfo{}, s.error("GetRev", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, item := range s.id[id] {
+		if item.info.Rev == rev {
+			return copyValue(item.data), item.info, nil
+		}
+	}
+	return nil, store.ItemInfo{}, s.error("GetRev", id, store.ErrNotFound, errors.Errorf("rev=%d not found", rev))
+} //memoryStore.GetRev()
 
-func (s memoryStore) Upd(id store.ID, v interface{}) (info store.ItemInfo, err error) {
+func (s *memoryStore) ListRevs(ctx context.Context, id store.ID) ([]store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, s.error("ListRevs", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	revs, ok := s.id[id]
 	if !ok {
-		return store.ItemInfo{}, errors.Errorf("id:\"%s\" not found", id)
+		return nil, s.error("ListRevs", id, store.ErrNotFound, nil)
+	}
+	info := make([]store.ItemInfo, len(revs))
+	for i, item := range revs {
+		info[i] = item.info
+	}
+	return info, nil
+} //memoryStore.ListRevs()
+
+func (s *memoryStore) GetHistory(ctx context.Context, id store.ID) ([]interface{}, []store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, s.error("GetHistory", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	revs, ok := s.id[id]
+	if !ok {
+		return nil, nil, s.error("GetHistory", id, store.ErrNotFound, nil)
+	}
+	items := make([]interface{}, len(revs))
+	info := make([]store.ItemInfo, len(revs))
+	for i, item := range revs {
+		items[i] = copyValue(item.data)
+		info[i] = item.info
+	}
+	return items, info, nil
+} //memoryStore.GetHistory()
+
+func (s *memoryStore) GetBy(ctx context.Context, max int, key map[string]interface{}) (items []interface{}, info []store.ItemInfo, err error) {
+	return s.find(ctx, "GetBy", max, store.KeyFilter(key))
+}
+
+func (s *memoryStore) Find(ctx context.Context, max int, filter store.Filter) (items []interface{}, info []store.ItemInfo, err error) {
+	return s.find(ctx, "Find", max, filter)
+}
+
+//find evaluates the filter on the latest revision of all items in order of id
+func (s *memoryStore) find(ctx context.Context, op string, max int, filter store.Filter) ([]interface{}, []store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, s.error(op, "", err, nil)
+	}
+	if err := filter.Validate(s.itemType); err != nil {
+		return nil, nil, s.error(op, "", store.ErrInvalidFilter, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := make([]string, 0, len(s.id))
+	for id := range s.id {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	items := make([]interface{}, 0)
+	info := make([]store.ItemInfo, 0)
+	for _, id := range ids {
+		if max > 0 && len(items) >= max {
+			break
+		}
+		lastRev, ok := s.latest(store.ID(id))
+		if !ok {
+			continue
+		}
+		ok, err := filter.Match(lastRev.data)
+		if err != nil {
+			return nil, nil, s.error(op, "", store.ErrInvalidFilter, err)
+		}
+		if ok {
+			items = append(items, copyValue(lastRev.data))
+			info = append(info, lastRev.info)
+		}
+	}
+	return items, info, nil
+} //memoryStore.find()
+
+func (s *memoryStore) Query(ctx context.Context, q store.Query) (store.Page, error) {
+	if err := ctx.Err(); err != nil {
+		return store.Page{}, s.error("Query", "", err, nil)
+	}
+	if err := q.Validate(s.itemType); err != nil {
+		return store.Page{}, s.error("Query", "", store.ErrInvalidFilter, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	type match struct {
+		item       memItem
+		sortValues []interface{}
+	}
+	matches := make([]match, 0)
+	for id := range s.id {
+		lastRev, ok := s.latest(id)
+		if !ok {
+			continue
+		}
+		ok, err := q.Filter.Match(lastRev.data)
+		if err != nil {
+			return store.Page{}, s.error("Query", "", store.ErrInvalidFilter, err)
+		}
+		if ok {
+			matches = append(matches, match{item: lastRev, sortValues: q.SortValues(lastRev.data, lastRev.info)})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return q.CompareSortValues(matches[i].sortValues, matches[j].sortValues) < 0
+	})
+
+	//skip up to and including the item in the cursor
+	if len(q.Cursor) > 0 {
+		after, _ := q.DecodeCursor(s.itemType)
+		matches = matches[sort.Search(len(matches), func(i int) bool {
+			return q.CompareSortValues(matches[i].sortValues, after) > 0
+		}):]
+	}
+
+	page := store.Page{
+		Items: make([]interface{}, 0),
+		Info:  make([]store.ItemInfo, 0),
+	}
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+		page.Next = store.EncodeCursor(matches[q.Limit-1].sortValues)
+	}
+	for _, m := range matches {
+		page.Items = append(page.Items, copyValue(m.item.data))
+		page.Info = append(page.Info, m.item.info)
+	}
+	return page, nil
+} //memoryStore.Query()
+
+func (s *memoryStore) Scan(ctx context.Context, filter store.Filter) (store.IIterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, s.error("Scan", "", err, nil)
+	}
+	if err := filter.Validate(s.itemType); err != nil {
+		return nil, s.error("Scan", "", store.ErrInvalidFilter, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	//snapshot of the latest revisions, filtered when iterating
+	snapshot := make([]memItem, 0, len(s.id))
+	for id := range s.id {
+		if lastRev, ok := s.latest(id); ok {
+			snapshot = append(snapshot, lastRev)
+		}
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].info.ID < snapshot[j].info.ID
+	})
+	return &memIterator{s: s, ctx: ctx, filter: filter, items: snapshot, index: -1}, nil
+} //memoryStore.Scan()
+
+//memIterator iterates over a snapshot of the store
+type memIterator struct {
+	s      *memoryStore
+	ctx    context.Context
+	filter store.Filter
+	items  []memItem
+	index  int
+	err    error
+}
+
+func (it *memIterator) Next() bool {
+	for it.err == nil && it.index+1 < len(it.items) {
+		if err := it.ctx.Err(); err != nil {
+			it.err = it.s.error("Scan", "", err, nil)
+			return false
+		}
+		it.index++
+		ok, err := it.filter.Match(it.items[it.index].data)
+		if err != nil {
+			it.err = it.s.error("Scan", "", store.ErrInvalidFilter, err)
+			return false
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *memIterator) Item() (interface{}, store.ItemInfo) {
+	item := it.items[it.index]
+	return copyValue(item.data), item.info
+}
+
+func (it *memIterator) Err() error {
+	return it.err
+}
+
+func (it *memIterator) Close() error {
+	it.items = nil
+	return nil
+}
+
+func (s *memoryStore) Count(ctx context.Context, filter store.Filter) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, s.error("Count", "", err, nil)
+	}
+	if err := filter.Validate(s.itemType); err != nil {
+		return 0, s.error("Count", "", store.ErrInvalidFilter, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := 0
+	for id := range s.id {
+		lastRev, ok := s.latest(id)
+		if !ok {
+			continue
+		}
+		ok, err := filter.Match(lastRev.data)
+		if err != nil {
+			return 0, s.error("Count", "", store.ErrInvalidFilter, err)
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+} //memoryStore.Count()
+
+func (s *memoryStore) Exists(ctx context.Context, id store.ID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, s.error("Exists", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.latest(id)
+	return ok, nil
+}
+
+func (s *memoryStore) Upd(ctx context.Context, id store.ID, v interface{}) (info store.ItemInfo, err error) {
+	return s.upd(ctx, id, 0, v)
+}
+
+func (s *memoryStore) UpdIf(ctx context.Context, id store.ID, expectedRev int, v interface{}) (info store.ItemInfo, err error) {
+	if expectedRev < 1 {
+		return store.ItemInfo{}, s.error("UpdIf", id, store.ErrInvalidValue, errors.Errorf("expectedRev=%d < 1", expectedRev))
+	}
+	return s.upd(ctx, id, expectedRev, v)
+}
+
+//upd creates a new revision if the latest is expectedRev, or any revision when expectedRev is 0
+func (s *memoryStore) upd(ctx context.Context, id store.ID, expectedRev int, v interface{}) (info store.ItemInfo, err error) {
+	op := "Upd"
+	if expectedRev != 0 {
+		op = "UpdIf"
+	}
+	if err := ctx.Err(); err != nil {
+		return store.ItemInfo{}, s.error(op, id, err, nil)
+	}
+	v, err = store.CheckValue(s.itemType, v)
+	if err != nil {
+		return store.ItemInfo{}, s.error(op, id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.updLocked(op, id, expectedRev, v, store.UserFromContext(ctx))
+}
+
+//updLocked does upd() while holding the mutex
+func (s *memoryStore) updLocked(op string, id store.ID, expectedRev int, v interface{}, user store.ID) (store.ItemInfo, error) {
+	lastRev, ok := s.latest(id)
+	if !ok {
+		return store.ItemInfo{}, s.error(op, id, store.ErrNotFound, nil)
+	}
+	if expectedRev != 0 && lastRev.info.Rev != expectedRev {
+		return store.ItemInfo{}, s.error(op, id, store.ConflictError{ID: id, Rev: lastRev.info.Rev, ExpectedRev: expectedRev}, nil)
+	}
+	if err := s.checkUnique(id, v); err != nil {
+		return store.ItemInfo{}, s.error(op, id, err, nil)
 	}
 
-	nrRevs := len(revs)
-	lastRev := revs[nrRevs-1]
+	return s.newRev(lastRev, copyValue(v), false, user), nil
+} //memoryStore.updLocked()
 
-	//create new rev
+//newRev appends a revision written by the user after lastRev
+//and must be called while holding the mutex
+func (s *memoryStore) newRev(lastRev memItem, v interface{}, deleted bool, user store.ID) store.ItemInfo {
 	newItem := lastRev
 	newItem.info.Rev = lastRev.info.Rev + 1
 	newItem.info.Timestamp = time.Now()
+	newItem.info.UserID = user
+	newItem.info.Deleted = deleted
 	newItem.data = v
-	revs = append(revs, newItem)
-	s.id[id] = revs
+	s.id[lastRev.info.ID] = append(s.id[lastRev.info.ID], newItem)
+	oldData, newData := lastRev.data, v
+	if lastRev.info.Deleted {
+		oldData = nil
+	}
+	if deleted {
+		newData = nil
+	}
+	s.reindex(lastRev.info.ID, oldData, newData)
+	s.retain(lastRev.info.ID, newItem.info.Timestamp)
+	op := store.ChangeUpd
+	if deleted {
+		op = store.ChangeDel
+	}
+	s.emit(op, newItem.info, v, lastRev.data)
+	return newItem.info
+}
+
+//retain removes the revisions of an item that are not kept by the retention policy,
+//returning the nr removed, and must be called while holding the mutex
+func (s *memoryStore) retain(id store.ID, now time.Time) int {
+	revs := s.id[id]
+	if s.retention.IsZero() || len(revs) < 2 {
+		return 0
+	}
+	info := make([]store.ItemInfo, len(revs))
+	for i, item := range revs {
+		info[i] = item.info
+	}
+	kept := make([]memItem, 0, len(revs))
+	for i, keep := range s.retention.Keep(info, now) {
+		if keep {
+			kept = append(kept, revs[i])
+		}
+	}
+	s.id[id] = kept
+	return len(revs) - len(kept)
+} //memoryStore.retain()
 
-	return newItem.info, nil
+func (s *memoryStore) Compact(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, s.error("Compact", "", err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := 0
+	now := time.Now()
+	for id := range s.id {
+		n += s.retain(id, now)
+	}
+	return n, nil
 }
 
-func (s memoryStore) Del(id store.ID) error {
+func (s *memoryStore) Del(ctx context.Context, id store.ID) error {
+	if err := ctx.Err(); err != nil {
+		return s.error("Del", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.del(id, store.UserFromContext(ctx))
+	return nil
+}
+
+//del writes a tombstone revision with the last data when soft deleting,
+//else removes the item, and must be called while holding the mutex
+func (s *memoryStore) del(id store.ID, user store.ID) {
+	lastRev, ok := s.latest(id)
+	if !s.softDelete {
+		delete(s.id, id)
+		if ok {
+			s.reindex(id, lastRev.data, nil)
+			s.emitDel(lastRev, user)
+		}
+		return
+	}
+	if ok {
+		s.newRev(lastRev, lastRev.data, true, user)
+	}
+}
+
+func (s *memoryStore) Undelete(ctx context.Context, id store.ID) (store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return store.ItemInfo{}, s.error("Undelete", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	revs, ok := s.id[id]
+	if !ok {
+		return store.ItemInfo{}, s.error("Undelete", id, store.ErrNotFound, nil)
+	}
+	lastRev := revs[len(revs)-1]
+	if !lastRev.info.Deleted {
+		return lastRev.info, nil
+	}
+	if err := s.checkUnique(id, lastRev.data); err != nil {
+		return store.ItemInfo{}, s.error("Undelete", id, err, nil)
+	}
+	return s.newRev(lastRev, lastRev.data, false, store.UserFromContext(ctx)), nil
+} //memoryStore.Undelete()
+
+func (s *memoryStore) Purge(ctx context.Context, id store.ID) error {
+	if err := ctx.Err(); err != nil {
+		return s.error("Purge", id, err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if lastRev, ok := s.latest(id); ok {
+		s.reindex(id, lastRev.data, nil)
+		s.emitDel(lastRev, store.UserFromContext(ctx))
+	}
 	delete(s.id, id)
 	return nil
 }
+
+func (s *memoryStore) AddMany(ctx context.Context, values []interface{}) ([]store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, s.error("AddMany", "", err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := make([]store.ItemInfo, len(values))
+	errs := make([]error, len(values))
+	user := store.UserFromContext(ctx)
+	for i, v := range values {
+		if v, errs[i] = store.CheckValue(s.itemType, v); errs[i] == nil {
+			errs[i] = s.checkUnique("", v)
+		}
+		if errs[i] != nil {
+			errs[i] = s.error("AddMany", "", errs[i], nil)
+			continue
+		}
+		info[i] = s.add(v, user)
+	}
+	return info, store.NewBatchError(errs)
+}
+
+func (s *memoryStore) GetMany(ctx context.Context, ids []store.ID) ([]interface{}, []store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, s.error("GetMany", "", err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	items := make([]interface{}, len(ids))
+	info := make([]store.ItemInfo, len(ids))
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		lastRev, ok := s.latest(id)
+		if !ok {
+			errs[i] = s.error("GetMany", id, store.ErrNotFound, nil)
+			continue
+		}
+		items[i] = copyValue(lastRev.data)
+		info[i] = lastRev.info
+	}
+	return items, info, store.NewBatchError(errs)
+} //memoryStore.GetMany()
+
+func (s *memoryStore) UpdMany(ctx context.Context, ids []store.ID, values []interface{}) ([]store.ItemInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, s.error("UpdMany", "", err, nil)
+	}
+	if len(ids) != len(values) {
+		return nil, s.error("UpdMany", "", store.ErrInvalidValue, errors.Errorf("%d ids != %d values", len(ids), len(values)))
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	info := make([]store.ItemInfo, len(ids))
+	errs := make([]error, len(ids))
+	user := store.UserFromContext(ctx)
+	for i, id := range ids {
+		v, err := store.CheckValue(s.itemType, values[i])
+		if err != nil {
+			errs[i] = s.error("UpdMany", id, err, nil)
+			continue
+		}
+		info[i], errs[i] = s.updLocked("UpdMany", id, 0, v, user)
+	}
+	return info, store.NewBatchError(errs)
+} //memoryStore.UpdMany()
+
+func (s *memoryStore) DelMany(ctx context.Context, ids []store.ID) error {
+	if err := ctx.Err(); err != nil {
+		return s.error("DelMany", "", err, nil)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := store.UserFromContext(ctx)
+	for _, id := range ids {
+		s.del(id, user)
+	}
+	return nil
+}
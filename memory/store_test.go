@@ -1,6 +1,9 @@
 package memory_test
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/go-msvc/store"
@@ -10,3 +13,61 @@ import (
 func Test1(t *testing.T) {
 	store.DoStoreTest(t, memory.Config{})
 }
+
+func TestSoftDelete(t *testing.T) {
+	store.DoStoreTest(t, memory.Config{SoftDelete: true})
+}
+
+func TestRetention(t *testing.T) {
+	store.DoStoreTest(t, memory.Config{Retention: store.Retention{MaxRevs: 2}})
+
+	s, err := memory.Config{Retention: store.Retention{MaxRevs: 3}}.New("counter", reflect.TypeOf(counter{}))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	info, _ := s.Add(counter{N: 0})
+	for i := 1; i <= 10; i++ {
+		if _, err := s.Upd(info.ID, counter{N: i}); err != nil {
+			t.Fatalf("failed to upd: %+v", err)
+		}
+	}
+	revs, err := s.ListRevs(info.ID)
+	if err != nil || len(revs) != 3 || revs[0].Rev != 9 || revs[2].Rev != 11 {
+		t.Fatalf("revs=%+v, err=%v", revs, err)
+	}
+	if n, err := s.Compact(); err != nil || n != 0 {
+		t.Fatalf("compact removed %d, err=%v", n, err)
+	}
+}
+
+type counter struct {
+	N int
+}
+
+func TestWatchOverflow(t *testing.T) {
+	s, err := memory.Config{}.New("counter", reflect.TypeOf(counter{}))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	w, err := s.Watch(store.All(), "")
+	if err != nil {
+		t.Fatalf("failed to watch: %+v", err)
+	}
+	defer w.Close()
+	info, _ := s.Add(counter{N: 0})
+	if !w.Next() {
+		t.Fatalf("no change: %v", w.Err())
+	}
+	token := w.Change().Token
+	for i := 1; i <= 1001; i++ {
+		if _, err := s.Upd(info.ID, counter{N: i}); err != nil {
+			t.Fatalf("failed to upd: %+v", err)
+		}
+	}
+	if w.Next() || !errors.Is(w.Err(), store.ErrExpired) {
+		t.Fatalf("slow watcher did not fail: %v", w.Err())
+	}
+	if !strings.Contains(w.Err().Error(), token) {
+		t.Fatalf("error does not tell where to resume: %v", w.Err())
+	}
+}
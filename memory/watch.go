@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-msvc/store"
+	"github.com/pkg/errors"
+)
+
+//maxChanges is the nr of recent changes kept to resume watches
+const maxChanges = 1000
+
+//emit sends a change to all watchers and must be called while holding the mutex
+func (s *memoryStore) emit(op store.ChangeOp, info store.ItemInfo, data interface{}, old interface{}) {
+	s.seq++
+	c := store.Change{Op: op, Info: info, Data: data, Old: old, Token: strconv.FormatInt(s.seq, 10)}
+	s.changes = append(s.changes, c)
+	if len(s.changes) > maxChanges {
+		s.changes = s.changes[len(s.changes)-maxChanges:]
+	}
+	for w := range s.watchers {
+		w.push(c)
+	}
+}
+
+//emitDel sends the change for a hard delete of the latest revision
+//and must be called while holding the mutex
+func (s *memoryStore) emitDel(lastRev memItem, user store.ID) {
+	info := lastRev.info
+	info.Timestamp = time.Now()
+	info.UserID = user
+	info.Deleted = true
+	s.emit(store.ChangeDel, info, lastRev.data, lastRev.data)
+}
+
+func (s *memoryStore) Watch(ctx context.Context, filter store.Filter, resume string) (store.IWatcher, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, s.error("Watch", "", err, nil)
+	}
+	if err := filter.Validate(s.itemType); err != nil {
+		return nil, s.error("Watch", "", store.ErrInvalidFilter, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &memWatcher{s: s, ctx: ctx, cancel: cancel, filter: filter, signal: make(chan struct{}, 1)}
+	if len(resume) > 0 {
+		after, err := strconv.ParseInt(resume, 10, 64)
+		first := s.seq - int64(len(s.changes)) //seq before the first kept change
+		if err != nil || after < first || after > s.seq {
+			cancel()
+			return nil, s.error("Watch", "", store.ErrExpired, errors.Errorf("cannot resume after \"%s\"", resume))
+		}
+		for _, c := range s.changes[after-first:] {
+			w.push(c)
+		}
+	}
+	s.watchers[w] = true
+	return w, nil
+} //memoryStore.Watch()
+
+//memWatcher queues the changes that match its filter until the caller takes them,
+//up to maxChanges, after which it fails with ErrExpired because the caller did
+//not keep up, and can resume from the last change it took if still kept
+type memWatcher struct {
+	s        *memoryStore
+	ctx      context.Context
+	cancel   context.CancelFunc
+	filter   store.Filter
+	mutex    sync.Mutex
+	queue    []store.Change
+	signal   chan struct{}
+	change   store.Change
+	err      error
+	closed   bool
+	overflow bool
+}
+
+//push is called by the store while holding the store mutex
+func (w *memWatcher) push(c store.Change) {
+	if ok, err := w.filter.Match(c.Data); err != nil || !ok {
+		return
+	}
+	w.mutex.Lock()
+	if len(w.queue) >= maxChanges {
+		w.overflow = true
+		w.queue = nil
+	}
+	if !w.overflow {
+		w.queue = append(w.queue, c)
+	}
+	w.mutex.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memWatcher) Next() bool {
+	for w.err == nil {
+		w.mutex.Lock()
+		if w.closed {
+			w.mutex.Unlock()
+			return false
+		}
+		if w.overflow {
+			w.mutex.Unlock()
+			w.err = w.s.error("Watch", "", store.ErrExpired, errors.Errorf("more than %d changes not taken, resume after \"%s\"", maxChanges, w.change.Token))
+			return false
+		}
+		if len(w.queue) > 0 {
+			w.change = w.queue[0]
+			w.queue = w.queue[1:]
+			w.mutex.Unlock()
+			return true
+		}
+		w.mutex.Unlock()
+
+		select {
+		case <-w.signal:
+		case <-w.ctx.Done():
+			w.mutex.Lock()
+			closed := w.closed
+			w.mutex.Unlock()
+			if closed {
+				return false
+			}
+			w.err = w.s.error("Watch", "", w.ctx.Err(), nil)
+		}
+	}
+	return false
+} //memWatcher.Next()
+
+//Change returns a copy of the data, which is shared with the other watchers
+func (w *memWatcher) Change() store.Change {
+	c := w.change
+	c.Data = copyValue(c.Data)
+	c.Old = copyValue(c.Old)
+	return c
+}
+
+func (w *memWatcher) Err() error {
+	return w.err
+}
+
+func (w *memWatcher) Close() error {
+	w.mutex.Lock()
+	w.closed = true
+	w.queue = nil
+	w.mutex.Unlock()
+	w.cancel()
+
+	w.s.mutex.Lock()
+	defer w.s.mutex.Unlock()
+	delete(w.s.watchers, w)
+	return nil
+}
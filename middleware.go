@@ -0,0 +1,409 @@
+package store
+
+import (
+	"context"
+	stderrors "errors"
+	"reflect"
+)
+
+//Middleware has hooks that Wrap() calls around the operations of a store.
+//Any hook may be nil. Before hooks veto the operation by returning an error,
+//which the operation returns in an *Error, and BeforeAdd/BeforeUpd may return
+//another value to write instead of v. After hooks are only called on success.
+type Middleware struct {
+	//BeforeRead is called before each read operation, with the id for
+	//operations on one item (Get, GetInfo, Exists, GetRev, ListRevs, GetHistory)
+	//and with an empty id for the others (GetBy, Find, Query, Scan, Watch, Count, GetMany)
+	BeforeRead func(ctx context.Context, op string, id ID) error
+
+	BeforeAdd func(ctx context.Context, v interface{}) (interface{}, error)
+	AfterAdd  func(ctx context.Context, v interface{}, info ItemInfo)
+
+	//BeforeUpd gets the latest revision before the update as old,
+	//and Upd/UpdIf only write if the item did not change after it was read.
+	//They are also called for Undelete, with the deleted revision as both
+	//old and v, and the value BeforeUpd returns is ignored because Undelete
+	//restores the deleted data.
+	BeforeUpd func(ctx context.Context, id ID, old, v interface{}) (interface{}, error)
+	AfterUpd  func(ctx context.Context, id ID, v interface{}, info ItemInfo)
+
+	//BeforeDel and AfterDel are called for Del, DelMany and Purge
+	BeforeDel func(ctx context.Context, id ID) error
+	AfterDel  func(ctx context.Context, id ID)
+
+	//Compact is not hooked, because it only removes old revisions
+	//as configured in the store retention
+}
+
+//Wrap returns the store with the middleware hooks around its operations
+//where the first middleware is the outer one, called first before
+//and last after each operation
+func Wrap(s IStore, mw ...Middleware) IStore {
+	cs := s.ContextStore()
+	for i := len(mw) - 1; i >= 0; i-- {
+		cs = hooked{s: cs, mw: mw[i]}
+	}
+	return Adapt(cs)
+}
+
+//hooked is an IContextStore that calls the middleware hooks around the store
+type hooked struct {
+	s  IContextStore
+	mw Middleware
+}
+
+//error describes a vetoed operation
+func (h hooked) error(op string, id ID, err error) error {
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{Store: h.s.Name(), Op: op, ID: id, Err: err}
+}
+
+func (h hooked) read(ctx context.Context, op string, id ID) error {
+	if h.mw.BeforeRead == nil {
+		return nil
+	}
+	if err := h.mw.BeforeRead(ctx, op, id); err != nil {
+		return h.error(op, id, err)
+	}
+	return nil
+}
+
+func (h hooked) Name() string {
+	return h.s.Name()
+}
+
+func (h hooked) Type() reflect.Type {
+	return h.s.Type()
+}
+
+func (h hooked) Add(ctx context.Context, v interface{}) (ItemInfo, error) {
+	if h.mw.BeforeAdd != nil {
+		var err error
+		if v, err = h.mw.BeforeAdd(ctx, v); err != nil {
+			return ItemInfo{}, h.error("Add", "", err)
+		}
+	}
+	info, err := h.s.Add(ctx, v)
+	if err == nil && h.mw.AfterAdd != nil {
+		h.mw.AfterAdd(ctx, v, info)
+	}
+	return info, err
+}
+
+func (h hooked) Get(ctx context.Context, id ID) (interface{}, ItemInfo, error) {
+	if err := h.read(ctx, "Get", id); err != nil {
+		return nil, ItemInfo{}, err
+	}
+	return h.s.Get(ctx, id)
+}
+
+func (h hooked) GetInfo(ctx context.Context, id ID) (ItemInfo, error) {
+	if err := h.read(ctx, "GetInfo", id); err != nil {
+		return ItemInfo{}, err
+	}
+	return h.s.GetInfo(ctx, id)
+}
+
+func (h hooked) GetBy(ctx context.Context, max int, key map[string]interface{}) ([]interface{}, []ItemInfo, error) {
+	if err := h.read(ctx, "GetBy", ""); err != nil {
+		return nil, nil, err
+	}
+	return h.s.GetBy(ctx, max, key)
+}
+
+func (h hooked) Find(ctx context.Context, max int, filter Filter) ([]interface{}, []ItemInfo, error) {
+	if err := h.read(ctx, "Find", ""); err != nil {
+		return nil, nil, err
+	}
+	return h.s.Find(ctx, max, filter)
+}
+
+func (h hooked) Query(ctx context.Context, q Query) (Page, error) {
+	if err := h.read(ctx, "Query", ""); err != nil {
+		return Page{}, err
+	}
+	return h.s.Query(ctx, q)
+}
+
+func (h hooked) Scan(ctx context.Context, filter Filter) (IIterator, error) {
+	if err := h.read(ctx, "Scan", ""); err != nil {
+		return nil, err
+	}
+	return h.s.Scan(ctx, filter)
+}
+
+func (h hooked) Watch(ctx context.Context, filter Filter, resume string) (IWatcher, error) {
+	if err := h.read(ctx, "Watch", ""); err != nil {
+		return nil, err
+	}
+	return h.s.Watch(ctx, filter, resume)
+}
+
+func (h hooked) Count(ctx context.Context, filter Filter) (int, error) {
+	if err := h.read(ctx, "Count", ""); err != nil {
+		return 0, err
+	}
+	return h.s.Count(ctx, filter)
+}
+
+func (h hooked) Exists(ctx context.Context, id ID) (bool, error) {
+	if err := h.read(ctx, "Exists", id); err != nil {
+		return false, err
+	}
+	return h.s.Exists(ctx, id)
+}
+
+func (h hooked) Upd(ctx context.Context, id ID, v interface{}) (ItemInfo, error) {
+	if h.mw.BeforeUpd == nil {
+		info, err := h.s.Upd(ctx, id, v)
+		h.afterUpd(ctx, id, v, info, err)
+		return info, err
+	}
+	//retry when another update got in between, so the hook saw the replaced revision
+	for {
+		info, err := h.upd(ctx, "Upd", id, 0, v)
+		if !stderrors.Is(err, ErrConflict) || ctx.Err() != nil {
+			return info, err
+		}
+	}
+}
+
+func (h hooked) UpdIf(ctx context.Context, id ID, expectedRev int, v interface{}) (ItemInfo, error) {
+	if expectedRev < 1 {
+		//not passed to upd(), where 0 means any revision
+		return h.s.UpdIf(ctx, id, expectedRev, v)
+	}
+	if h.mw.BeforeUpd == nil {
+		info, err := h.s.UpdIf(ctx, id, expectedRev, v)
+		h.afterUpd(ctx, id, v, info, err)
+		return info, err
+	}
+	return h.upd(ctx, "UpdIf", id, expectedRev, v)
+}
+
+//upd reads the old value for BeforeUpd and only writes if it is still the latest
+func (h hooked) upd(ctx context.Context, op string, id ID, expectedRev int, v interface{}) (ItemInfo, error) {
+	old, oldInfo, err := h.s.Get(ctx, id)
+	if err != nil {
+		return ItemInfo{}, err
+	}
+	if expectedRev != 0 && oldInfo.Rev != expectedRev {
+		return ItemInfo{}, &Error{Store: h.s.Name(), Op: op, ID: id, Err: ConflictError{ID: id, Rev: oldInfo.Rev, ExpectedRev: expectedRev}}
+	}
+	if v, err = h.mw.BeforeUpd(ctx, id, old, v); err != nil {
+		return ItemInfo{}, h.error(op, id, err)
+	}
+	info, err := h.s.UpdIf(ctx, id, oldInfo.Rev, v)
+	h.afterUpd(ctx, id, v, info, err)
+	return info, err
+} //hooked.upd()
+
+func (h hooked) afterUpd(ctx context.Context, id ID, v interface{}, info ItemInfo, err error) {
+	if err == nil && h.mw.AfterUpd != nil {
+		h.mw.AfterUpd(ctx, id, v, info)
+	}
+}
+
+func (h hooked) AddMany(ctx context.Context, values []interface{}) ([]ItemInfo, error) {
+	if h.mw.BeforeAdd == nil && h.mw.AfterAdd == nil {
+		return h.s.AddMany(ctx, values)
+	}
+	errs := make([]error, len(values))
+	todo := make([]int, 0, len(values))
+	todoValues := make([]interface{}, 0, len(values))
+	for i, v := range values {
+		if h.mw.BeforeAdd != nil {
+			var err error
+			if v, err = h.mw.BeforeAdd(ctx, v); err != nil {
+				errs[i] = h.error("AddMany", "", err)
+				continue
+			}
+		}
+		todo = append(todo, i)
+		todoValues = append(todoValues, v)
+	}
+
+	infos := make([]ItemInfo, len(values))
+	if len(todo) > 0 {
+		done, err := h.s.AddMany(ctx, todoValues)
+		if _, ok := err.(*BatchError); err != nil && !ok {
+			return nil, err
+		}
+		doneErrs := BatchErrors(err, len(todo))
+		for j, i := range todo {
+			infos[i], errs[i] = done[j], doneErrs[j]
+			if errs[i] == nil && h.mw.AfterAdd != nil {
+				h.mw.AfterAdd(ctx, todoValues[j], infos[i])
+			}
+		}
+	}
+	return infos, NewBatchError(errs)
+} //hooked.AddMany()
+
+func (h hooked) GetMany(ctx context.Context, ids []ID) ([]interface{}, []ItemInfo, error) {
+	if err := h.read(ctx, "GetMany", ""); err != nil {
+		return nil, nil, err
+	}
+	return h.s.GetMany(ctx, ids)
+}
+
+//UpdMany passes the revisions read before the batch as old values to BeforeUpd
+func (h hooked) UpdMany(ctx context.Context, ids []ID, values []interface{}) ([]ItemInfo, error) {
+	if h.mw.BeforeUpd == nil && h.mw.AfterUpd == nil {
+		return h.s.UpdMany(ctx, ids, values)
+	}
+	if len(ids) != len(values) {
+		return h.s.UpdMany(ctx, ids, values) //let the store report it
+	}
+	errs := make([]error, len(ids))
+	todo := make([]int, 0, len(ids))
+	todoIDs := make([]ID, 0, len(ids))
+	todoValues := make([]interface{}, 0, len(ids))
+	if h.mw.BeforeUpd != nil {
+		olds, _, err := h.s.GetMany(ctx, ids)
+		if _, ok := err.(*BatchError); err != nil && !ok {
+			return nil, err
+		}
+		getErrs := BatchErrors(err, len(ids))
+		for i, id := range ids {
+			if getErrs[i] != nil {
+				errs[i] = getErrs[i]
+				continue
+			}
+			v, err := h.mw.BeforeUpd(ctx, id, olds[i], values[i])
+			if err != nil {
+				errs[i] = h.error("UpdMany", id, err)
+				continue
+			}
+			todo = append(todo, i)
+			todoIDs = append(todoIDs, id)
+			todoValues = append(todoValues, v)
+		}
+	} else {
+		for i, id := range ids {
+			todo = append(todo, i)
+			todoIDs = append(todoIDs, id)
+			todoValues = append(todoValues, values[i])
+		}
+	}
+
+	infos := make([]ItemInfo, len(ids))
+	if len(todo) > 0 {
+		done, err := h.s.UpdMany(ctx, todoIDs, todoValues)
+		if _, ok := err.(*BatchError); err != nil && !ok {
+			return nil, err
+		}
+		doneErrs := BatchErrors(err, len(todo))
+		for j, i := range todo {
+			infos[i], errs[i] = done[j], doneErrs[j]
+			h.afterUpd(ctx, ids[i], todoValues[j], infos[i], errs[i])
+		}
+	}
+	return infos, NewBatchError(errs)
+} //hooked.UpdMany()
+
+func (h hooked) DelMany(ctx context.Context, ids []ID) error {
+	errs := make([]error, len(ids))
+	todo := make([]int, 0, len(ids))
+	todoIDs := make([]ID, 0, len(ids))
+	for i, id := range ids {
+		if h.mw.BeforeDel != nil {
+			if err := h.mw.BeforeDel(ctx, id); err != nil {
+				errs[i] = h.error("DelMany", id, err)
+				continue
+			}
+		}
+		todo = append(todo, i)
+		todoIDs = append(todoIDs, id)
+	}
+	if len(todo) > 0 {
+		err := h.s.DelMany(ctx, todoIDs)
+		if _, ok := err.(*BatchError); err != nil && !ok {
+			return err
+		}
+		doneErrs := BatchErrors(err, len(todo))
+		for j, i := range todo {
+			errs[i] = doneErrs[j]
+			if errs[i] == nil && h.mw.AfterDel != nil {
+				h.mw.AfterDel(ctx, ids[i])
+			}
+		}
+	}
+	return NewBatchError(errs)
+} //hooked.DelMany()
+
+func (h hooked) GetRev(ctx context.Context, id ID, rev int) (interface{}, ItemInfo, error) {
+	if err := h.read(ctx, "GetRev", id); err != nil {
+		return nil, ItemInfo{}, err
+	}
+	return h.s.GetRev(ctx, id, rev)
+}
+
+func (h hooked) ListRevs(ctx context.Context, id ID) ([]ItemInfo, error) {
+	if err := h.read(ctx, "ListRevs", id); err != nil {
+		return nil, err
+	}
+	return h.s.ListRevs(ctx, id)
+}
+
+func (h hooked) GetHistory(ctx context.Context, id ID) ([]interface{}, []ItemInfo, error) {
+	if err := h.read(ctx, "GetHistory", id); err != nil {
+		return nil, nil, err
+	}
+	return h.s.GetHistory(ctx, id)
+}
+
+func (h hooked) Del(ctx context.Context, id ID) error {
+	return h.del(ctx, "Del", id, h.s.Del)
+}
+
+//Undelete is hooked like an update from the deleted revision
+func (h hooked) Undelete(ctx context.Context, id ID) (ItemInfo, error) {
+	if h.mw.BeforeUpd == nil && h.mw.AfterUpd == nil {
+		return h.s.Undelete(ctx, id)
+	}
+	revs, err := h.s.ListRevs(ctx, id)
+	if err != nil {
+		return ItemInfo{}, err
+	}
+	if len(revs) == 0 || !revs[len(revs)-1].Deleted {
+		return h.s.Undelete(ctx, id) //not deleted, so nothing changes
+	}
+	old, _, err := h.s.GetRev(ctx, id, revs[len(revs)-1].Rev)
+	if err != nil {
+		return ItemInfo{}, err
+	}
+	if h.mw.BeforeUpd != nil {
+		if _, err := h.mw.BeforeUpd(ctx, id, old, old); err != nil {
+			return ItemInfo{}, h.error("Undelete", id, err)
+		}
+	}
+	info, err := h.s.Undelete(ctx, id)
+	h.afterUpd(ctx, id, old, info, err)
+	return info, err
+} //hooked.Undelete()
+
+func (h hooked) Purge(ctx context.Context, id ID) error {
+	return h.del(ctx, "Purge", id, h.s.Purge)
+}
+
+func (h hooked) del(ctx context.Context, op string, id ID, del func(context.Context, ID) error) error {
+	if h.mw.BeforeDel != nil {
+		if err := h.mw.BeforeDel(ctx, id); err != nil {
+			return h.error(op, id, err)
+		}
+	}
+	if err := del(ctx, id); err != nil {
+		return err
+	}
+	if h.mw.AfterDel != nil {
+		h.mw.AfterDel(ctx, id)
+	}
+	return nil
+}
+
+func (h hooked) Compact(ctx context.Context) (int, error) {
+	return h.s.Compact(ctx)
+}
@@ -0,0 +1,151 @@
+package store_test
+
+import (
+	"context"
+	stderrors "errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-msvc/store"
+	"github.com/go-msvc/store/memory"
+)
+
+//wrapConfig makes wrapped memory stores to run DoStoreTest through the middleware
+type wrapConfig struct {
+	mw []store.Middleware
+}
+
+func (c wrapConfig) FromURL(u *url.URL) (store.IStoreConfig, error) {
+	return c, nil
+}
+
+func (c wrapConfig) New(itemName string, itemType reflect.Type) (store.IStore, error) {
+	s, err := memory.Config{}.New(itemName, itemType)
+	if err != nil {
+		return nil, err
+	}
+	return store.Wrap(s, c.mw...), nil
+}
+
+func TestWrapStore(t *testing.T) {
+	//hooks that do not change anything must not break any operation
+	var n int64 //hooks are called concurrently
+	store.DoStoreTest(t, wrapConfig{mw: []store.Middleware{{
+		BeforeRead: func(ctx context.Context, op string, id store.ID) error { atomic.AddInt64(&n, 1); return nil },
+		BeforeAdd:  func(ctx context.Context, v interface{}) (interface{}, error) { return v, nil },
+		AfterAdd:   func(ctx context.Context, v interface{}, info store.ItemInfo) { atomic.AddInt64(&n, 1) },
+		BeforeUpd:  func(ctx context.Context, id store.ID, old, v interface{}) (interface{}, error) { return v, nil },
+		AfterUpd:   func(ctx context.Context, id store.ID, v interface{}, info store.ItemInfo) { atomic.AddInt64(&n, 1) },
+		BeforeDel:  func(ctx context.Context, id store.ID) error { return nil },
+		AfterDel:   func(ctx context.Context, id store.ID) { atomic.AddInt64(&n, 1) },
+	}}})
+	if n == 0 {
+		t.Fatalf("hooks were not called")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	log := []string{}
+	logger := func(name string) store.Middleware {
+		return store.Middleware{
+			BeforeAdd: func(ctx context.Context, v interface{}) (interface{}, error) {
+				log = append(log, name+".BeforeAdd")
+				return v, nil
+			},
+			AfterAdd: func(ctx context.Context, v interface{}, info store.ItemInfo) {
+				log = append(log, name+".AfterAdd")
+			},
+		}
+	}
+	denied := errors.Errorf("denied")
+	defaults := store.Middleware{
+		BeforeAdd: func(ctx context.Context, v interface{}) (interface{}, error) {
+			p := v.(UserProfile)
+			if len(p.Name) == 0 {
+				p.Name = "anonymous"
+			}
+			return p, nil
+		},
+		BeforeUpd: func(ctx context.Context, id store.ID, old, v interface{}) (interface{}, error) {
+			if old.(UserProfile).Name == "admin" {
+				return nil, denied
+			}
+			return v, nil
+		},
+		BeforeDel: func(ctx context.Context, id store.ID) error {
+			return denied
+		},
+	}
+	s := store.Wrap(store.MustNew(UserProfile{}, store.WithBackend("memory")), logger("a"), logger("b"), defaults)
+
+	info, err := s.Add(UserProfile{})
+	if err != nil {
+		t.Fatalf("failed to add: %+v", err)
+	}
+	if strings.Join(log, ",") != "a.BeforeAdd,b.BeforeAdd,b.AfterAdd,a.AfterAdd" {
+		t.Fatalf("hooks called in wrong order: %v", log)
+	}
+	if v, _, err := s.Get(info.ID); err != nil || v.(UserProfile).Name != "anonymous" {
+		t.Fatalf("hook did not set default: %+v, %v", v, err)
+	}
+
+	if _, err := s.Upd(info.ID, UserProfile{Name: "admin"}); err != nil {
+		t.Fatalf("failed to upd: %+v", err)
+	}
+	if _, err := s.Upd(info.ID, UserProfile{Name: "other"}); !stderrors.Is(err, denied) {
+		t.Fatalf("upd of admin was not denied: %v", err)
+	}
+	if err := s.Del(info.ID); !stderrors.Is(err, denied) {
+		t.Fatalf("del was not denied: %v", err)
+	}
+	if exists, _ := s.Exists(info.ID); !exists {
+		t.Fatalf("denied del deleted the item")
+	}
+
+	err = s.DelMany([]store.ID{info.ID})
+	if errs := store.BatchErrors(err, 1); !stderrors.Is(errs[0], denied) {
+		t.Fatalf("del many was not denied: %v", err)
+	}
+}
+
+func TestWrapUndelete(t *testing.T) {
+	denied := errors.Errorf("denied")
+	nrAfter := 0
+	veto := store.Middleware{
+		BeforeUpd: func(ctx context.Context, id store.ID, old, v interface{}) (interface{}, error) {
+			if old.(UserProfile).Name == "admin" {
+				return nil, denied
+			}
+			return v, nil
+		},
+		AfterUpd: func(ctx context.Context, id store.ID, v interface{}, info store.ItemInfo) {
+			nrAfter++
+		},
+	}
+	s, err := memory.Config{SoftDelete: true}.New("profile", reflect.TypeOf(UserProfile{}))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	s = store.Wrap(s, veto)
+
+	admin, _ := s.Add(UserProfile{Name: "admin"})
+	other, _ := s.Add(UserProfile{Name: "other"})
+	for _, info := range []store.ItemInfo{admin, other} {
+		if err := s.Del(info.ID); err != nil {
+			t.Fatalf("failed to del: %+v", err)
+		}
+	}
+	if _, err := s.Undelete(admin.ID); !stderrors.Is(err, denied) {
+		t.Fatalf("undelete of admin was not denied: %v", err)
+	}
+	if exists, _ := s.Exists(admin.ID); exists || nrAfter != 0 {
+		t.Fatalf("denied undelete restored the item")
+	}
+	if info, err := s.Undelete(other.ID); err != nil || info.Rev != 3 || nrAfter != 1 {
+		t.Fatalf("failed to undelete: info=%+v, after=%d, err=%v", info, nrAfter, err)
+	}
+}
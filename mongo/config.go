@@ -0,0 +1,180 @@
+package mongo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const (
+	//defaultOpTimeout is used when Config.OpTimeout is not set
+	defaultOpTimeout = 5 * time.Second
+	//defaultConnectTimeout is used when Config.ConnectTimeout is not set
+	defaultConnectTimeout = 10 * time.Second
+)
+
+//clientOptions returns the mongo driver options for the URI
+//with the connection fields that are set
+func (c Config) clientOptions() (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(c.URI)
+	if c.ConnectTimeout > 0 {
+		opts.SetConnectTimeout(c.ConnectTimeout)
+	}
+	if c.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+	if c.MinPoolSize > 0 {
+		opts.SetMinPoolSize(c.MinPoolSize)
+	}
+	if len(c.AppName) > 0 {
+		opts.SetAppName(c.AppName)
+	}
+
+	if len(c.WriteConcern) > 0 || c.Journal || c.WriteTimeout > 0 {
+		wcOpts := []writeconcern.Option{}
+		switch n, err := strconv.Atoi(c.WriteConcern); {
+		case len(c.WriteConcern) == 0:
+		case c.WriteConcern == "majority":
+			wcOpts = append(wcOpts, writeconcern.WMajority())
+		case err == nil && n > 0:
+			wcOpts = append(wcOpts, writeconcern.W(n))
+		case err == nil:
+			//updates must be acknowledged to detect conflicts
+			return nil, errors.Errorf("WriteConcern=%d must be at least 1", n)
+		default:
+			wcOpts = append(wcOpts, writeconcern.WTagSet(c.WriteConcern))
+		}
+		if c.Journal {
+			wcOpts = append(wcOpts, writeconcern.J(true))
+		}
+		if c.WriteTimeout > 0 {
+			wcOpts = append(wcOpts, writeconcern.WTimeout(c.WriteTimeout))
+		}
+		opts.SetWriteConcern(writeconcern.New(wcOpts...))
+	}
+	if opts.WriteConcern != nil && !opts.WriteConcern.Acknowledged() {
+		return nil, errors.Errorf("unacknowledged writes from the URI cannot detect conflicts")
+	}
+
+	switch c.ReadConcern {
+	case "":
+	case "local", "available", "majority", "linearizable", "snapshot":
+		opts.SetReadConcern(readconcern.New(readconcern.Level(c.ReadConcern)))
+	default:
+		return nil, errors.Errorf("unknown ReadConcern=%s", c.ReadConcern)
+	}
+
+	//the client reads from the primary, because updates read the latest
+	//revision and transactions can only read from the primary, while the
+	//plain reads use the collection with readPref()
+	if _, err := c.readPref(); err != nil {
+		return nil, err
+	}
+	opts.SetReadPreference(readpref.Primary())
+
+	if c.TLS || len(c.TLSCAFile) > 0 || len(c.TLSCertFile) > 0 || len(c.TLSKeyFile) > 0 || c.TLSInsecure {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	if len(c.Username) > 0 {
+		opts.SetAuth(options.Credential{
+			AuthMechanism: c.AuthMechanism,
+			AuthSource:    c.AuthSource,
+			Username:      c.Username,
+			Password:      c.Password,
+		})
+	} else if len(c.Password) > 0 || len(c.AuthSource) > 0 || len(c.AuthMechanism) > 0 {
+		return nil, errors.Errorf("credentials without Username")
+	}
+	return opts, nil
+} //Config.clientOptions()
+
+//readPref returns the read preference for the plain reads, from ReadPreference
+//or else from the URI, which defaults to primary
+func (c Config) readPref() (*readpref.ReadPref, error) {
+	if len(c.ReadPreference) == 0 {
+		if c.MaxStaleness > 0 {
+			return nil, errors.Errorf("MaxStaleness without ReadPreference")
+		}
+		if rp := options.Client().ApplyURI(c.URI).ReadPreference; rp != nil {
+			return rp, nil
+		}
+		return readpref.Primary(), nil
+	}
+	mode, err := readpref.ModeFromString(c.ReadPreference)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ReadPreference=%s", c.ReadPreference)
+	}
+	rpOpts := []readpref.Option{}
+	if c.MaxStaleness > 0 {
+		rpOpts = append(rpOpts, readpref.WithMaxStaleness(c.MaxStaleness))
+	}
+	rp, err := readpref.New(mode, rpOpts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ReadPreference=%s", c.ReadPreference)
+	}
+	return rp, nil
+} //Config.readPref()
+
+//redactedURI returns the URI without the password, to log and in errors.
+//It does not use url.Parse(), which fails on the list of hosts in a mongo URI.
+func (c Config) redactedURI() string {
+	i := strings.Index(c.URI, "://")
+	if i < 0 {
+		return c.URI
+	}
+	rest := c.URI[i+3:]
+	hosts := rest
+	if j := strings.IndexAny(rest, "/?"); j >= 0 {
+		hosts = rest[:j]
+	}
+	at := strings.LastIndex(hosts, "@")
+	if at < 0 {
+		return c.URI
+	}
+	user := hosts[:at]
+	if j := strings.Index(user, ":"); j >= 0 {
+		user = user[:j]
+	}
+	return c.URI[:i+3] + user + rest[at:]
+} //Config.redactedURI()
+
+//tlsConfig loads the TLS files
+func (c Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.TLSInsecure}
+	if len(c.TLSCAFile) > 0 {
+		pem, err := ioutil.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read TLSCAFile")
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates in TLSCAFile=%s", c.TLSCAFile)
+		}
+	}
+	if len(c.TLSCertFile) > 0 || len(c.TLSKeyFile) > 0 {
+		if len(c.TLSCertFile) == 0 || len(c.TLSKeyFile) == 0 {
+			return nil, errors.Errorf("TLSCertFile and TLSKeyFile must both be set")
+		}
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load TLSCertFile and TLSKeyFile")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+} //Config.tlsConfig()
@@ -0,0 +1,184 @@
+package mongo
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-msvc/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//latestFilter selects only the latest revision documents,
+//because older revision copies have "id" set to the item _id,
+//of items that are not soft deleted
+var latestFilter = bson.M{"id": primitive.ObjectID{}, "deleted": bson.M{"$ne": true}}
+
+//liveFilter selects the latest revision of one item unless it is soft deleted
+func liveFilter(objID primitive.ObjectID) bson.M {
+	return bson.M{"_id": objID, "deleted": bson.M{"$ne": true}}
+}
+
+//mongoFilter translates a store filter on items of itemType
+//to a mongo query on the "data" in the documents
+func mongoFilter(itemType reflect.Type, f store.Filter) (bson.M, error) {
+	switch f.Op {
+	case store.OpAll:
+		return bson.M{}, nil
+	case store.OpAnd, store.OpOr, store.OpNot:
+		list := bson.A{}
+		for _, sub := range f.Filters {
+			m, err := mongoFilter(itemType, sub)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, m)
+		}
+		if len(list) == 0 {
+			if f.Op == store.OpOr {
+				return nil, errors.Errorf("%s without filters", f.Op)
+			}
+			return bson.M{}, nil
+		}
+		switch f.Op {
+		case store.OpAnd:
+			return bson.M{"$and": list}, nil
+		case store.OpOr:
+			return bson.M{"$or": list}, nil
+		}
+		return bson.M{"$nor": list}, nil
+	}
+
+	fields, err := store.FieldByPath(itemType, f.Field)
+	if err != nil {
+		return nil, err
+	}
+	path := "data." + bsonPath(itemType, fields)
+	switch f.Op {
+	case store.OpEq:
+		return bson.M{path: f.Value}, nil
+	case store.OpNe:
+		return bson.M{path: bson.M{"$ne": f.Value}}, nil
+	case store.OpLt:
+		return bson.M{path: bson.M{"$lt": f.Value}}, nil
+	case store.OpLte:
+		return bson.M{path: bson.M{"$lte": f.Value}}, nil
+	case store.OpGt:
+		return bson.M{path: bson.M{"$gt": f.Value}}, nil
+	case store.OpGte:
+		return bson.M{path: bson.M{"$gte": f.Value}}, nil
+	case store.OpIn:
+		return bson.M{path: bson.M{"$in": f.Value}}, nil
+	case store.OpPrefix:
+		prefix, _ := f.Value.(string)
+		return bson.M{path: primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)}}, nil
+	case store.OpRegex:
+		expr, _ := f.Value.(string)
+		return bson.M{path: primitive.Regex{Pattern: expr}}, nil
+	case store.OpExists:
+		return bson.M{path: bson.M{"$exists": true, "$ne": nil}}, nil
+	}
+	return nil, errors.Errorf("unknown filter op \"%s\"", f.Op)
+} //mongoFilter()
+
+//sortPath returns the document key path for a sort field
+func sortPath(itemType reflect.Type, field string) (string, error) {
+	switch field {
+	case store.SortByID:
+		return "_id", nil
+	case store.SortByTimestamp:
+		return "ts", nil
+	}
+	fields, err := store.FieldByPath(itemType, field)
+	if err != nil {
+		return "", err
+	}
+	return "data." + bsonPath(itemType, fields), nil
+}
+
+//cursorFilter selects the documents sorted after the item with cursor values,
+//i.e. for sort keys k1,k2,...,_id and cursor values v1,v2,...,id:
+//	k1 after v1 or (k1==v1 and k2 after v2) or ... or (k1==v1 and ... and _id>id)
+//where nil values are before all others
+func cursorFilter(itemType reflect.Type, q store.Query, values []interface{}) (bson.M, error) {
+	keys := q.SortKeys()
+	paths := make([]string, len(keys))
+	for i, key := range keys {
+		path, err := sortPath(itemType, key.Field)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = path
+		if key.Field == store.SortByID {
+			id, _ := values[i].(store.ID)
+			objID, err := primitive.ObjectIDFromHex(string(id))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid cursor id")
+			}
+			values[i] = objID
+		}
+	}
+
+	or := bson.A{}
+	for i, key := range keys {
+		and := bson.A{}
+		for j := 0; j < i; j++ {
+			and = append(and, bson.M{paths[j]: values[j]})
+		}
+		switch {
+		case values[i] == nil && key.Desc:
+			continue //nothing after nil in descending order
+		case values[i] == nil:
+			and = append(and, bson.M{paths[i]: bson.M{"$ne": nil}})
+		case key.Desc:
+			and = append(and, bson.M{"$or": bson.A{
+				bson.M{paths[i]: bson.M{"$lt": values[i]}},
+				bson.M{paths[i]: nil},
+			}})
+		default:
+			and = append(and, bson.M{paths[i]: bson.M{"$gt": values[i]}})
+		}
+		or = append(or, bson.M{"$and": and})
+	}
+	return bson.M{"$or": or}, nil
+} //cursorFilter()
+
+//bsonPath returns the dotted bson key path of the struct fields from store.FieldByPath()
+//using the bson tag names or lowercase field names like the driver does
+func bsonPath(t reflect.Type, fields []reflect.StructField) string {
+	keys := make([]string, 0, len(fields))
+	for _, f := range fields {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		//promoted fields have an index into each embedded struct
+		for _, i := range f.Index {
+			for t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			sf := t.Field(i)
+			if key, inline := bsonKey(sf); !inline {
+				keys = append(keys, key)
+			}
+			t = sf.Type
+		}
+	}
+	return strings.Join(keys, ".")
+} //bsonPath()
+
+//bsonKey returns the bson key of a struct field and true if the field is inlined
+func bsonKey(f reflect.StructField) (string, bool) {
+	tag := strings.Split(f.Tag.Get("bson"), ",")
+	for _, opt := range tag[1:] {
+		if opt == "inline" {
+			return "", true
+		}
+	}
+	if len(tag[0]) > 0 {
+		return tag[0], false
+	}
+	return strings.ToLower(f.Name), false
+} //bsonKey()
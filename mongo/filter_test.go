@@ -0,0 +1,45 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-msvc/store"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type audit struct {
+	By string `bson:"by"`
+}
+
+type item struct {
+	audit
+	Name    string
+	Address struct {
+		City string `bson:"town"`
+	}
+	Tags  []string `bson:"labels,omitempty"`
+	Extra struct {
+		Note string
+	} `bson:",inline"`
+}
+
+func TestMongoFilter(t *testing.T) {
+	tests := []struct {
+		filter store.Filter
+		query  bson.M
+	}{
+		{store.Eq("Name", "a"), bson.M{"data.name": "a"}},
+		{store.Gt("Address.City", "a"), bson.M{"data.address.town": bson.M{"$gt": "a"}}},
+		{store.In("Tags", "x", "y"), bson.M{"data.labels": bson.M{"$in": []interface{}{"x", "y"}}}},
+		{store.Eq("By", "me"), bson.M{"data.audit.by": "me"}},
+		{store.Eq("Extra.Note", "n"), bson.M{"data.note": "n"}},
+		{store.Not(store.Eq("Name", "a")), bson.M{"$nor": bson.A{bson.M{"data.name": "a"}}}},
+	}
+	for _, test := range tests {
+		query, err := mongoFilter(reflect.TypeOf(item{}), test.filter)
+		if err != nil || !reflect.DeepEqual(query, test.query) {
+			t.Fatalf("%+v -> %+v != %+v, err=%v", test.filter, query, test.query, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package mongo
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/go-msvc/log"
+	"github.com/go-msvc/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//indexModels returns the mongo indexes on the item data for the indexes
+//declared in the item type. Unique indexes only apply to the latest revision
+//of items that are not deleted and have all the fields, so they ignore old
+//revision copies and tombstones. The partial filter cannot use {$ne: true},
+//so items written without "deleted" must be set to false, see backfillDeleted().
+func indexModels(itemType reflect.Type, indexes []store.Index) ([]mongo.IndexModel, error) {
+	models := make([]mongo.IndexModel, 0, len(indexes))
+	for _, index := range indexes {
+		keys := bson.D{}
+		partial := bson.D{{Key: "id", Value: primitive.ObjectID{}}, {Key: "deleted", Value: false}}
+		for _, field := range index.Fields {
+			fields, err := store.FieldByPath(itemType, field)
+			if err != nil {
+				return nil, err
+			}
+			path := "data." + bsonPath(itemType, fields)
+			keys = append(keys, bson.E{Key: path, Value: 1})
+			partial = append(partial, bson.E{Key: path, Value: bson.M{"$exists": true}})
+		}
+		opts := options.Index().SetName(index.Name)
+		if index.Unique {
+			opts.SetUnique(true).SetPartialFilterExpression(partial)
+		}
+		models = append(models, mongo.IndexModel{Keys: keys, Options: opts})
+	}
+	return models, nil
+} //indexModels()
+
+//ensureIndexes creates the indexes that the store needs and those declared
+//in the item type when there is no index with the same name yet, and returns
+//the names of the indexes created
+func ensureIndexes(ctx context.Context, collection *mongo.Collection, copies *mongo.Collection, itemType reflect.Type) ([]string, error) {
+	indexes, err := store.Indexes(itemType)
+	if err != nil {
+		return nil, err
+	}
+	models, err := indexModels(itemType, indexes)
+	if err != nil {
+		return nil, err
+	}
+	//latest revisions are polled by timestamp in Watch()
+	models = append(models, mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}, {Key: "ts", Value: 1}},
+		Options: options.Index().SetName("id_ts"),
+	})
+	//old revision copies are read by item id and rev, and when they are in
+	//the same collection, the latest revisions with a zero id are not in this index
+	copyModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "id", Value: 1}, {Key: "rev", Value: 1}},
+		Options: options.Index().SetName("id_rev").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"id": bson.M{"$gt": primitive.ObjectID{}}}),
+	}
+	if copies == collection {
+		models = append(models, copyModel)
+	}
+	missing, err := missingIndexes(ctx, collection, models)
+	if err != nil {
+		return nil, err
+	}
+	unique := map[string]bool{}
+	for _, index := range indexes {
+		unique[index.Name] = index.Unique
+	}
+	for _, model := range missing {
+		if unique[*model.Options.Name] {
+			if err := backfillDeleted(ctx, collection); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	created, err := createIndexes(ctx, collection, missing)
+	if err != nil || copies == collection {
+		return created, err
+	}
+	missing, err = missingIndexes(ctx, copies, []mongo.IndexModel{copyModel})
+	if err != nil {
+		return nil, err
+	}
+	createdCopy, err := createIndexes(ctx, copies, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range createdCopy {
+		created = append(created, copies.Name()+"."+name)
+	}
+	return created, nil
+} //ensureIndexes()
+
+//backfillDeleted sets "deleted" to false in the latest revisions that were
+//written before items could be soft deleted, so that they are in the unique
+//indexes, which only apply to {deleted: false}
+func backfillDeleted(ctx context.Context, collection *mongo.Collection) error {
+	result, err := collection.UpdateMany(ctx,
+		bson.M{"id": primitive.ObjectID{}, "deleted": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deleted": false}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Infof("Set deleted=false in %d %s items for unique indexes", result.ModifiedCount, collection.Name())
+	}
+	return nil
+} //backfillDeleted()
+
+//missingIndexes returns the models of the indexes that do not exist
+//in the collection with the same name
+func missingIndexes(ctx context.Context, collection *mongo.Collection, models []mongo.IndexModel) ([]mongo.IndexModel, error) {
+	cur, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	existing := map[string]bool{}
+	for cur.Next(ctx) {
+		index := struct {
+			Name string `bson:"name"`
+		}{}
+		if err := cur.Decode(&index); err != nil {
+			return nil, err
+		}
+		existing[index.Name] = true
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	missing := []mongo.IndexModel{}
+	for _, model := range models {
+		if !existing[*model.Options.Name] {
+			missing = append(missing, model)
+		}
+	}
+	return missing, nil
+} //missingIndexes()
+
+//createIndexes creates the indexes and returns their names
+func createIndexes(ctx context.Context, collection *mongo.Collection, models []mongo.IndexModel) ([]string, error) {
+	if len(models) == 0 {
+		return nil, nil
+	}
+	return collection.Indexes().CreateMany(ctx, models)
+}
+
+//duplicateError returns the store error for a mongo duplicate key error message
+//like "E11000 duplicate key error collection: db.user index: Msisdn dup key: ..."
+func duplicateError(msg string) store.DuplicateError {
+	name := ""
+	if i := strings.Index(msg, " index: "); i >= 0 {
+		name = msg[i+len(" index: "):]
+		if j := strings.Index(name, " dup key"); j >= 0 {
+			name = name[:j]
+		}
+	}
+	return store.DuplicateError{Index: name}
+}
@@ -0,0 +1,36 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-msvc/store"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexModels(t *testing.T) {
+	type subscriber struct {
+		Msisdn  string `bson:"nr" store:"unique"`
+		Address struct {
+			City string `bson:"town" store:"index=city"`
+		}
+		Zone int `store:"index=city"`
+	}
+	itemType := reflect.TypeOf(subscriber{})
+	indexes, err := store.Indexes(itemType)
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	models, err := indexModels(itemType, indexes)
+	if err != nil || len(models) != 2 {
+		t.Fatalf("got %d models, err=%+v", len(models), err)
+	}
+	if keys := models[0].Keys.(bson.D); len(keys) != 1 || keys[0].Key != "data.nr" ||
+		*models[0].Options.Name != "Msisdn" || models[0].Options.Unique == nil || !*models[0].Options.Unique {
+		t.Fatalf("unique index %+v %+v", models[0].Keys, models[0].Options)
+	}
+	if keys := models[1].Keys.(bson.D); len(keys) != 2 || keys[0].Key != "data.address.town" || keys[1].Key != "data.zone" ||
+		*models[1].Options.Name != "city" || models[1].Options.Unique != nil {
+		t.Fatalf("compound index %+v %+v", models[1].Keys, models[1].Options)
+	}
+}
@@ -0,0 +1,103 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-msvc/log"
+	"github.com/go-msvc/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//migrateBatchSize is the nr of revision copies moved at a time by MigrateHistory()
+const migrateBatchSize = 1000
+
+//MigrateHistory moves the copies of old revisions of the item from the item
+//collection to the history collection of Config.SeparateHistory, and returns
+//the nr of copies moved. Each copy is written to the history collection
+//before it is deleted from the item collection, so it can be stopped and
+//run again, also while the store is used with SeparateHistory.
+func MigrateHistory(ctx context.Context, c Config, itemName string) (int, error) {
+	if err := c.Validate(); err != nil {
+		return 0, errors.Wrapf(err, "invalid config")
+	}
+	client, err := c.connect(ctx, itemName, "MigrateHistory")
+	if err != nil {
+		return 0, err
+	}
+	defer client.Disconnect(context.Background())
+
+	collection := client.Database(c.Database).Collection(itemName)
+	copies := client.Database(c.Database).Collection(c.historyName(itemName))
+	n := 0
+	for {
+		cur, err := collection.Find(ctx,
+			bson.M{"id": bson.M{"$gt": primitive.ObjectID{}}},
+			options.Find().SetLimit(migrateBatchSize))
+		if err != nil {
+			return n, &store.Error{Store: itemName, Op: "MigrateHistory", Err: errorKind(err), Cause: err}
+		}
+		models := []mongo.WriteModel{}
+		copyIDs := bson.A{}
+		for cur.Next(ctx) {
+			doc := bson.M{}
+			if err := cur.Decode(&doc); err != nil {
+				cur.Close(ctx)
+				return n, &store.Error{Store: itemName, Op: "MigrateHistory", Err: errorKind(err), Cause: err}
+			}
+			models = append(models, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": doc["_id"]}).
+				SetReplacement(doc).
+				SetUpsert(true))
+			copyIDs = append(copyIDs, doc["_id"])
+		}
+		err = cur.Err()
+		cur.Close(ctx)
+		if err != nil {
+			return n, &store.Error{Store: itemName, Op: "MigrateHistory", Err: errorKind(err), Cause: err}
+		}
+		if len(models) == 0 {
+			log.Debugf("Moved %d old revisions of %s to %s", n, itemName, copies.Name())
+			return n, nil
+		}
+
+		if _, err := copies.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			//a copy that is already in history, e.g. made after the store
+			//was switched to SeparateHistory, fails on the id+rev index
+			if bulkErr, ok := err.(mongo.BulkWriteException); !ok || bulkErr.WriteConcernError != nil || !isDuplicatesOnly(bulkErr) {
+				return n, &store.Error{Store: itemName, Op: "MigrateHistory", Err: errorKind(err), Cause: err}
+			}
+		}
+		delResult, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": copyIDs}})
+		if err != nil {
+			return n, &store.Error{Store: itemName, Op: "MigrateHistory", Err: errorKind(err), Cause: err}
+		}
+		if delResult.DeletedCount == 0 {
+			//fine when another migration deleted them, but when they are still
+			//there, the next batch would be the same, so stop rather than loop forever
+			left, err := collection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": copyIDs}})
+			if err != nil {
+				return n, &store.Error{Store: itemName, Op: "MigrateHistory", Err: errorKind(err), Cause: err}
+			}
+			if left > 0 {
+				return n, &store.Error{Store: itemName, Op: "MigrateHistory", Err: store.ErrConflict,
+					Cause: errors.Errorf("copied %d old revisions to %s but could not delete them", left, copies.Name())}
+			}
+		}
+		n += int(delResult.DeletedCount)
+	}
+} //MigrateHistory()
+
+//isDuplicatesOnly is true when all the write errors are duplicate key errors
+func isDuplicatesOnly(err mongo.BulkWriteException) bool {
+	for _, we := range err.WriteErrors {
+		if !isDuplicateKey(we.Code) {
+			return false
+		}
+	}
+	return true
+}
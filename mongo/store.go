@@ -2,7 +2,11 @@ package mongo
 
 import (
 	"context"
+	stderrors "errors"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-msvc/errors"
@@ -13,20 +17,74 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-//todo: limit nr of revisions kept
-//todo: index on id, id+rev
-
 func init() {
 	store.Register("mongo", Config{})
 }
 
-//Config to make a mongo store
+//Config to make a mongo store. The connection fields that are set override
+//the same options in the URI.
 type Config struct {
 	URI      string
 	Database string
+
+	//OpTimeout limits each operation when the caller's context has no deadline, default 5s
+	OpTimeout time.Duration
+	//ConnectTimeout limits connecting to the server in New(), default 10s
+	ConnectTimeout time.Duration
+	//MaxPoolSize and MinPoolSize limit the nr of connections to each server
+	MaxPoolSize uint64
+	MinPoolSize uint64
+	//WriteConcern is "majority", the nr of members (at least 1) or a tag set name
+	//that must acknowledge writes, with Journal to wait for the journal and
+	//WriteTimeout to limit the wait. Transactions always use "majority" writes
+	//and "snapshot" reads.
+	WriteConcern string
+	Journal      bool
+	WriteTimeout time.Duration
+	//ReadConcern is "local", "available", "majority", "linearizable" or "snapshot"
+	ReadConcern string
+	//ReadPreference is "primary", "primaryPreferred", "secondary", "secondaryPreferred"
+	//or "nearest", with MaxStaleness for the other modes than primary.
+	//It applies to Get, GetInfo, Exists, GetBy, Find, Query, Scan, Count and GetMany,
+	//while updates and history always read from the primary.
+	ReadPreference string
+	MaxStaleness   time.Duration
+	//TLS connects with TLS, which is implied by the other TLS fields:
+	//TLSCAFile is the PEM file with the CAs to trust instead of the system CAs,
+	//TLSCertFile and TLSKeyFile are the PEM files of the client certificate
+	TLS            bool
+	TLSCAFile      string
+	TLSCertFile    string
+	TLSKeyFile     string
+	TLSInsecure    bool
+	//Username, Password, AuthSource (default "admin") and AuthMechanism
+	//(default negotiated with the server) are the credentials
+	Username      string
+	Password      string
+	AuthSource    string
+	AuthMechanism string
+	//AppName is logged by the server for each connection
+	AppName string
+
+	//SoftDelete makes Del() write a tombstone revision instead of removing the item
+	SoftDelete bool
+	//Retention limits the older revisions kept of each item
+	Retention store.Retention
+	//WatchPollInterval is how often Watch() polls when change streams are not
+	//supported, which is only on replica sets, default 1s
+	WatchPollInterval time.Duration
+	//NoIndexes stops New() from creating the indexes that the store needs and
+	//those declared in the item type, for when a DBA manages the indexes
+	NoIndexes bool
+	//SeparateHistory keeps the copies of old revisions in a history collection
+	//so that the item collection only has the latest revisions, see also
+	//MigrateHistory() to move the copies of an existing store
+	SeparateHistory bool
+	//HistoryCollection is the name of the history collection, where "%s" is
+	//replaced by the item name, default "%s_history"
+	HistoryCollection string
 }
 
 //Validate the config
@@ -37,69 +95,161 @@ func (c *Config) Validate() error {
 	if len(c.Database) == 0 {
 		return errors.Errorf("missing database name")
 	}
-	log.Debugf("Validated %T:%+v", c, *c)
+	if c.OpTimeout == 0 {
+		c.OpTimeout = defaultOpTimeout
+	}
+	if c.ConnectTimeout == 0 {
+		c.ConnectTimeout = defaultConnectTimeout
+	}
+	for name, d := range map[string]time.Duration{
+		"OpTimeout":         c.OpTimeout,
+		"ConnectTimeout":    c.ConnectTimeout,
+		"WriteTimeout":      c.WriteTimeout,
+		"MaxStaleness":      c.MaxStaleness,
+		"WatchPollInterval": c.WatchPollInterval,
+	} {
+		if d < 0 {
+			return errors.Errorf("negative %s=%v", name, d)
+		}
+	}
+	if c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize {
+		return errors.Errorf("MinPoolSize=%d > MaxPoolSize=%d", c.MinPoolSize, c.MaxPoolSize)
+	}
+	if _, err := c.clientOptions(); err != nil {
+		return err
+	}
+	logged := *c
+	logged.URI = c.redactedURI()
+	if len(logged.Password) > 0 {
+		logged.Password = "***"
+	}
+	log.Debugf("Validated %T:%+v", c, logged)
 	return nil
 }
 
+//FromURL makes the config from a store URL in the form
+//	mongo://[user:pass@]host[:port][,host[:port]...]/database[?options]
+//where scheme "mongo+srv" is used for "mongodb+srv" URIs
+//and the URI options are passed to the mongo driver as is,
+//except "softDelete", "noIndexes" and "separateHistory" which
+//set the Config fields with the same names to true|false
+func (c Config) FromURL(u *url.URL) (store.IStoreConfig, error) {
+	database := strings.Trim(u.Path, "/")
+	if len(database) == 0 || strings.Contains(database, "/") {
+		return nil, errors.Errorf("mongo store URL path must be the database name")
+	}
+	uri := *u
+	query := u.Query()
+	for _, opt := range []struct {
+		name  string
+		value *bool
+	}{
+		{"softDelete", &c.SoftDelete},
+		{"noIndexes", &c.NoIndexes},
+		{"separateHistory", &c.SeparateHistory},
+	} {
+		if len(query.Get(opt.name)) == 0 {
+			continue
+		}
+		value, err := strconv.ParseBool(query.Get(opt.name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s=%s", opt.name, query.Get(opt.name))
+		}
+		*opt.value = value
+		query.Del(opt.name)
+		uri.RawQuery = query.Encode()
+	}
+	uri.Scheme = "mongodb" + strings.TrimPrefix(u.Scheme, "mongo")
+	uri.Path = "/"
+	uri.RawPath = ""
+	c.URI = uri.String()
+	c.Database = database
+	return c, nil
+} //Config.FromURL()
+
 //New creates the mongo store
 func (c Config) New(itemName string, itemType reflect.Type) (store.IStore, error) {
 	if err := c.Validate(); err != nil {
 		return nil, errors.Wrapf(err, "invalid config")
 	}
 	if err := store.ValidateUserType(itemType); err != nil {
-		return nil, errors.Wrapf(err, "cannot store %v", itemType)
-	}
-
-	client, err := mongo.NewClient(options.Client().ApplyURI(c.URI))
-	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to create mongo client to %s", c.URI)
+		return nil, &store.Error{Store: itemName, Op: "New", Err: store.ErrInvalidType, Cause: err}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), c.ConnectTimeout)
 	defer cancel()
 
-	err = client.Connect(ctx)
+	client, err := c.connect(ctx, itemName, "New")
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to connect to mongo %s", c.URI)
+		return nil, err
 	}
-
-	err = client.Ping(ctx, readpref.Primary())
-	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to check mongo %s", c.URI)
+	collection := client.Database(c.Database).Collection(itemName)
+	rp, _ := c.readPref() //checked in Validate()
+	reads := client.Database(c.Database).Collection(itemName, options.Collection().SetReadPreference(rp))
+	copies := collection
+	if c.SeparateHistory {
+		copies = client.Database(c.Database).Collection(c.historyName(itemName))
 	}
 
-	collection := client.Database(c.Database).Collection(itemName)
+	if !c.NoIndexes {
+		created, err := ensureIndexes(ctx, collection, copies, itemType)
+		if err != nil {
+			return nil, &store.Error{Store: itemName, Op: "New", Err: errorKind(err), Cause: errors.Wrapf(err, "Failed to create indexes")}
+		}
+		if len(created) > 0 {
+			log.Infof("Created indexes %v on mongo store %s", created, itemName)
+		}
+	}
 
-	//indexes:
-	//	all docs implicitly have a unique _id (the mongo doc id)
-	//	we add unique key on our item id and rev: id+rev
-
-	//make unique index on "id"+"rev" combination to find old versions
-	//(current version is not in this index because "id" is not set.
-	// indexModel := mongo.IndexModel{
-	// 	Keys: bson.M{
-	// 		"id":  1, //index in ascending order (-1 for descending order)
-	// 		"rev": 1, //index in ascending order (-1 for descending order)
-	// 	},
-	// 	Options: options.Index().SetUnique(true),
-	// }
-	// index, err := collection.Indexes().CreateOne(ctx, indexModel)
-
-	// 	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
-	// 	index := mongo.IndexModel{}
-	// index.Keys = bsonx.Doc{{Key: *key, Value: bsonx.Int32(int32(*value))}}
-	// if *unique {
-	// 	index.Options = bsonx.Doc{{Key: "unique", Value: bsonx.Boolean(true)}}
-	// }
-	// collection.Indexes().CreateOne(context.Background(), index, opts)
-
-	log.Debugf("Created mongo store(%s,%s,%s)", c.URI, c.Database, itemName)
-	return &mongoStore{
+	log.Debugf("Created mongo store(%s,%s,%s)", c.redactedURI(), c.Database, itemName)
+	return store.Adapt(&mongoStore{
 		itemName:   itemName,
 		itemType:   itemType,
 		docType:    docType(itemType),
 		collection: collection,
-	}, nil
+		reads:      reads,
+		copies:     copies,
+		softDelete: c.SoftDelete,
+		retention:  c.Retention,
+		opTimeout:  c.OpTimeout,
+
+		transactions:      supportsTransactions(ctx, client),
+		watchPollInterval: c.WatchPollInterval,
+	}), nil
+}
+
+//connect returns a client connected to the mongo server, after Validate()
+func (c Config) connect(ctx context.Context, itemName string, op string) (*mongo.Client, error) {
+	opts, err := c.clientOptions()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config")
+	}
+	client, err := mongo.NewClient(opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create mongo client to %s", c.redactedURI())
+	}
+
+	err = client.Connect(ctx)
+	if err != nil {
+		return nil, &store.Error{Store: itemName, Op: op, Err: store.ErrUnavailable, Cause: errors.Wrapf(err, "Failed to connect to mongo %s", c.redactedURI())}
+	}
+
+	//check with the read preference, so that reads from secondaries
+	//can start while there is no primary
+	rp, _ := c.readPref() //checked in clientOptions()
+	err = client.Ping(ctx, rp)
+	if err != nil {
+		return nil, &store.Error{Store: itemName, Op: op, Err: store.ErrUnavailable, Cause: errors.Wrapf(err, "Failed to check mongo %s", c.redactedURI())}
+	}
+	return client, nil
+} //Config.connect()
+
+//historyName is the name of the history collection of an item
+func (c Config) historyName(itemName string) string {
+	if len(c.HistoryCollection) == 0 {
+		return itemName + "_history"
+	}
+	return strings.ReplaceAll(c.HistoryCollection, "%s", itemName)
 }
 
 type mongoStore struct {
@@ -107,6 +257,91 @@ type mongoStore struct {
 	itemType   reflect.Type
 	docType    reflect.Type
 	collection *mongo.Collection
+	//reads is collection with Config.ReadPreference for the plain reads,
+	//while collection reads from the primary
+	reads *mongo.Collection
+	//copies is the collection with the copies of old revisions,
+	//which is collection unless Config.SeparateHistory
+	copies     *mongo.Collection
+	softDelete bool
+	retention  store.Retention
+	opTimeout  time.Duration
+	//transactions is true when the deployment supports multi-document transactions
+	transactions bool
+
+	watchPollInterval time.Duration
+}
+
+//opContext returns the context for one operation, which is the caller's context
+//limited to Config.OpTimeout if the caller did not set a deadline
+func (s mongoStore) opContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.opTimeout)
+}
+
+//error describes a failed operation with the store error matching the mongo error
+func (s mongoStore) error(op string, id store.ID, err error) error {
+	if storeErr, ok := err.(*store.Error); ok {
+		opErr := *storeErr
+		opErr.Op = op
+		return &opErr
+	}
+	if conflict, ok := err.(store.ConflictError); ok {
+		return &store.Error{Store: s.itemName, Op: op, ID: id, Err: conflict}
+	}
+	return &store.Error{Store: s.itemName, Op: op, ID: id, Err: errorKind(err), Cause: err}
+}
+
+//objectID returns the mongo _id of an item
+func (s mongoStore) objectID(op string, id store.ID) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return objID, &store.Error{Store: s.itemName, Op: op, ID: id, Err: store.ErrNotFound, Cause: err}
+	}
+	return objID, nil
+}
+
+//errorKind returns the store error that matches an error from the mongo driver
+//or nil when none applies
+func errorKind(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return store.ErrNotFound
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if isDuplicateKey(we.Code) {
+				return duplicateError(we.Message)
+			}
+		}
+	case mongo.BulkWriteException:
+		for _, we := range e.WriteErrors {
+			if isDuplicateKey(we.Code) {
+				return duplicateError(we.Message)
+			}
+		}
+	case mongo.CommandError:
+		if isDuplicateKey(int(e.Code)) {
+			return duplicateError(e.Message)
+		}
+		if e.HasErrorLabel("NetworkError") {
+			return store.ErrUnavailable
+		}
+	}
+	if strings.Contains(err.Error(), "server selection error") {
+		return store.ErrUnavailable
+	}
+	return nil
+} //errorKind()
+
+//isDuplicateKey is true for mongo duplicate key error codes
+func isDuplicateKey(code int) bool {
+	return code == 11000 || code == 11001 || code == 12582
 }
 
 func (s mongoStore) Name() string {
@@ -117,32 +352,38 @@ func (s mongoStore) Type() reflect.Type {
 	return s.itemType
 }
 
-func (s mongoStore) Add(v interface{}) (store.ItemInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s mongoStore) Add(ctx context.Context, v interface{}) (store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
 	defer cancel()
 
+	v, err := store.CheckValue(s.itemType, v)
+	if err != nil {
+		return store.ItemInfo{}, s.error("Add", "", err)
+	}
+
 	info := store.ItemInfo{
 		Rev:       1,
 		Timestamp: time.Now().Truncate(time.Millisecond),
-		//UserID: ...,
+		UserID:    store.UserFromContext(ctx),
 	}
 	result, err := s.collection.InsertOne(
 		ctx,
 		bson.M{
 			//"_id" is assigned by mongo
-			"rev":  info.Rev,
-			"id":   primitive.ObjectID{},
-			"ts":   info.Timestamp,
-			"user": primitive.ObjectID{},
-			"data": v,
+			"rev":     info.Rev,
+			"id":      primitive.ObjectID{},
+			"ts":      info.Timestamp,
+			"user-id": string(info.UserID),
+			"deleted": false,
+			"data":    v,
 		})
 	if err != nil {
-		return store.ItemInfo{}, errors.Wrapf(err, "failed to insert into mongo")
+		return store.ItemInfo{}, s.error("Add", "", err)
 	}
 
 	oid, ok := result.InsertedID.(primitive.ObjectID)
 	if !ok {
-		return store.ItemInfo{}, errors.Wrapf(err, "failed to get inserted id")
+		return store.ItemInfo{}, s.error("Add", "", errors.Errorf("failed to get inserted id"))
 	}
 
 	info.ID = store.ID(oid.Hex())
@@ -150,70 +391,183 @@ func (s mongoStore) Add(v interface{}) (store.ItemInfo, error) {
 	return info, nil
 } //mongoStore.Add()
 
-func (s mongoStore) Get(id store.ID) (interface{}, store.ItemInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s mongoStore) Get(ctx context.Context, id store.ID) (interface{}, store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
 	defer cancel()
+	return s.get(ctx, s.reads, id)
+}
 
-	objID, _ := primitive.ObjectIDFromHex(string(id))
-	docPtrValue := reflect.New(s.docType)
-	err := s.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(docPtrValue.Interface())
+//get reads the latest revision from the collection, which is s.collection
+//to read from the primary before an update
+func (s mongoStore) get(ctx context.Context, collection *mongo.Collection, id store.ID) (interface{}, store.ItemInfo, error) {
+	objID, err := s.objectID("Get", id)
 	if err != nil {
-		return nil, store.ItemInfo{}, errors.Wrapf(err, "failed to get id=%s: %v", id, err)
+		return nil, store.ItemInfo{}, err
 	}
-	docValue := docPtrValue.Elem()
-	info := store.ItemInfo{
-		ID:        store.ID(docValue.Field(IDFieldIndex).Interface().(primitive.ObjectID).Hex()),
-		Rev:       docValue.Field(RevFieldIndex).Interface().(int),
-		Timestamp: docValue.Field(TimestampFieldIndex).Interface().(time.Time),
-		UserID:    store.ID(docValue.Field(UserIDFieldIndex).Interface().(primitive.ObjectID).Hex()),
+	docPtrValue := reflect.New(s.docType)
+	err = collection.FindOne(ctx, liveFilter(objID)).Decode(docPtrValue.Interface())
+	if err != nil {
+		return nil, store.ItemInfo{}, s.error("Get", id, err)
 	}
+	data, info := docItem(docPtrValue.Elem())
 	log.Debugf("Got %s:{id:\"%s\",rev:%d}", s.itemName, info.ID, info.Rev)
-	return docValue.Field(DataFieldIndex).Interface(), info, nil
-} //mongoStore.Get()
+	return data, info, nil
+} //mongoStore.get()
 
-func (s mongoStore) GetInfo(id store.ID) (store.ItemInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s mongoStore) GetInfo(ctx context.Context, id store.ID) (store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
 	defer cancel()
 
-	objID, _ := primitive.ObjectIDFromHex(string(id))
+	objID, err := s.objectID("GetInfo", id)
+	if err != nil {
+		return store.ItemInfo{}, err
+	}
 	head := docHead{}
-	err := s.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&head)
+	err = s.reads.FindOne(ctx, liveFilter(objID)).Decode(&head)
 	if err != nil {
-		return store.ItemInfo{}, errors.Wrapf(err, "failed to get id=%s: %v", id, err)
+		return store.ItemInfo{}, s.error("GetInfo", id, err)
 	}
 
-	info := store.ItemInfo{
-		ID:        store.ID(head.ID.Hex()),
-		Rev:       head.Rev,
-		Timestamp: head.Timestamp,
-		UserID:    store.ID(head.UserID.Hex()),
-	}
+	info := head.info()
 	log.Debugf("Got info for %s:{id:\"%s\",rev:%d}", s.itemName, info.ID, info.Rev)
 	return info, nil
 } //mongoStore.GetInfo()
 
-func (s mongoStore) GetBy(max int, key map[string]interface{}) ([]interface{}, []store.ItemInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s mongoStore) GetRev(ctx context.Context, id store.ID, rev int) (interface{}, store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	objID, err := s.objectID("GetRev", id)
+	if err != nil {
+		return nil, store.ItemInfo{}, err
+	}
+	docPtrValue := reflect.New(s.docType)
+	err = s.collection.FindOne(ctx, bson.M{"_id": objID, "rev": rev}).Decode(docPtrValue.Interface())
+	if err == mongo.ErrNoDocuments {
+		//not the latest, look for a copy of the older revision
+		err = s.copies.FindOne(ctx, bson.M{"id": objID, "rev": rev}).Decode(docPtrValue.Interface())
+	}
+	if err != nil {
+		return nil, store.ItemInfo{}, s.error("GetRev", id, err)
+	}
+	data, info := docItem(docPtrValue.Elem())
+	log.Debugf("Got %s:{id:\"%s\",rev:%d}", s.itemName, info.ID, info.Rev)
+	return data, info, nil
+} //mongoStore.GetRev()
+
+func (s mongoStore) ListRevs(ctx context.Context, id store.ID) ([]store.ItemInfo, error) {
+	_, infoArray, err := s.history(ctx, id, false)
+	return infoArray, err
+}
+
+func (s mongoStore) GetHistory(ctx context.Context, id store.ID) ([]interface{}, []store.ItemInfo, error) {
+	return s.history(ctx, id, true)
+}
+
+//history returns all revisions of an item in ascending rev order, ending with the latest
+//data is only retrieved and returned when withData is true
+func (s mongoStore) history(ctx context.Context, id store.ID, withData bool) ([]interface{}, []store.ItemInfo, error) {
+	op := "ListRevs"
+	if withData {
+		op = "GetHistory"
+	}
+
+	ctx, cancel := s.opContext(ctx)
 	defer cancel()
 
-	// objID, _ := primitive.ObjectIDFromHex(string(id))
-	// head := docHead{}
+	objID, err := s.objectID(op, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	findOptions := options.Find().SetSort(bson.M{"rev": 1})
+	if !withData {
+		findOptions.SetProjection(bson.M{"data": 0})
+	}
 
-	mongoKey := bson.M{}
-	for keyFieldName, keyFieldValue := range key {
-		mongoKey["data."+keyFieldName] = keyFieldValue
+	//older revisions then the latest
+	dataArray := make([]interface{}, 0)
+	infoArray := make([]store.ItemInfo, 0)
+	for _, query := range []struct {
+		collection *mongo.Collection
+		filter     bson.M
+	}{
+		{s.copies, bson.M{"id": objID}},
+		{s.collection, bson.M{"_id": objID}},
+	} {
+		cur, err := query.collection.Find(ctx, query.filter, findOptions)
+		if err != nil {
+			return nil, nil, s.error(op, id, err)
+		}
+		for cur.Next(ctx) {
+			docPtrValue := reflect.New(s.docType)
+			if err := cur.Decode(docPtrValue.Interface()); err != nil {
+				cur.Close(ctx)
+				return nil, nil, s.error(op, id, err)
+			}
+			data, info := docItem(docPtrValue.Elem())
+			if n := len(infoArray); n > 0 && infoArray[n-1].Rev == info.Rev {
+				//a copy made by an update that failed before it replaced the latest
+				//revision has the same rev as the latest, so keep only the latest
+				infoArray = infoArray[:n-1]
+				if withData {
+					dataArray = dataArray[:n-1]
+				}
+			}
+			if withData {
+				dataArray = append(dataArray, data)
+			}
+			infoArray = append(infoArray, info)
+		}
+		err = cur.Err()
+		cur.Close(ctx)
+		if err != nil {
+			return nil, nil, s.error(op, id, err)
+		}
+	}
+	if len(infoArray) == 0 {
+		return nil, nil, s.error(op, id, mongo.ErrNoDocuments)
 	}
+	log.Debugf("Got %d revisions of %s:{id:\"%s\"}", len(infoArray), s.itemName, id)
+	return dataArray, infoArray, nil
+} //mongoStore.history()
 
-	log.Debugf("GetBy(key:%+v)", mongoKey)
-	cur, err := s.collection.Find(ctx, mongoKey)
+func (s mongoStore) GetBy(ctx context.Context, max int, key map[string]interface{}) ([]interface{}, []store.ItemInfo, error) {
+	return s.find(ctx, "GetBy", max, store.KeyFilter(key))
+}
+
+func (s mongoStore) Find(ctx context.Context, max int, filter store.Filter) ([]interface{}, []store.ItemInfo, error) {
+	return s.find(ctx, "Find", max, filter)
+}
+
+//find returns the latest revision of items that match the filter
+func (s mongoStore) find(ctx context.Context, op string, max int, filter store.Filter) ([]interface{}, []store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if err := filter.Validate(s.itemType); err != nil {
+		return nil, nil, &store.Error{Store: s.itemName, Op: op, Err: store.ErrInvalidFilter, Cause: err}
+	}
+	mongoKey, err := mongoFilter(s.itemType, filter)
+	if err != nil {
+		return nil, nil, &store.Error{Store: s.itemName, Op: op, Err: store.ErrInvalidFilter, Cause: err}
+	}
+	mongoKey = bson.M{"$and": bson.A{latestFilter, mongoKey}}
+
+	findOptions := options.Find().SetSort(bson.M{"_id": 1})
+	if max > 0 {
+		findOptions.SetLimit(int64(max))
+	}
+
+	log.Debugf("%s(key:%+v)", op, mongoKey)
+	cur, err := s.reads.Find(ctx, mongoKey, findOptions)
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, "failed to find(%+v): %v", key, err)
+		return nil, nil, s.error(op, "", err)
 	}
 	defer cur.Close(ctx)
 
 	dataArray := make([]interface{}, 0)
 	infoArray := make([]store.ItemInfo, 0)
-	for cur.Next(ctx) && len(dataArray) < max {
+	for cur.Next(ctx) {
 		docPtrValue := reflect.New(s.docType)
 		err := cur.Decode(docPtrValue.Interface())
 		if err != nil {
@@ -221,102 +575,817 @@ func (s mongoStore) GetBy(max int, key map[string]interface{}) ([]interface{}, [
 			continue
 		}
 
-		docValue := docPtrValue.Elem()
-		info := store.ItemInfo{
-			ID:        store.ID(docValue.Field(IDFieldIndex).Interface().(primitive.ObjectID).Hex()),
-			Rev:       docValue.Field(RevFieldIndex).Interface().(int),
-			Timestamp: docValue.Field(TimestampFieldIndex).Interface().(time.Time),
-			UserID:    store.ID(docValue.Field(UserIDFieldIndex).Interface().(primitive.ObjectID).Hex()),
-		}
-		dataArray = append(dataArray, docValue.Field(DataFieldIndex).Interface())
+		data, info := docItem(docPtrValue.Elem())
+		dataArray = append(dataArray, data)
 		infoArray = append(infoArray, info)
 	} //for each doc
+	if err := cur.Err(); err != nil {
+		return nil, nil, s.error(op, "", err)
+	}
 	return dataArray, infoArray, nil
-} //mongoStore.GetBy()
+} //mongoStore.find()
 
-func (s mongoStore) Upd(id store.ID, newData interface{}) (store.ItemInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s mongoStore) Query(ctx context.Context, q store.Query) (store.Page, error) {
+	ctx, cancel := s.opContext(ctx)
 	defer cancel()
 
-	//get current item with header info
-	oldData, oldInfo, err := s.Get(id)
+	if err := q.Validate(s.itemType); err != nil {
+		return store.Page{}, &store.Error{Store: s.itemName, Op: "Query", Err: store.ErrInvalidFilter, Cause: err}
+	}
+	mongoKey, err := mongoFilter(s.itemType, q.Filter)
 	if err != nil {
-		return store.ItemInfo{}, errors.Wrapf(err, "cannot get item to upd")
+		return store.Page{}, &store.Error{Store: s.itemName, Op: "Query", Err: store.ErrInvalidFilter, Cause: err}
+	}
+	and := bson.A{latestFilter, mongoKey}
+	if len(q.Cursor) > 0 {
+		values, _ := q.DecodeCursor(s.itemType)
+		after, err := cursorFilter(s.itemType, q, values)
+		if err != nil {
+			return store.Page{}, &store.Error{Store: s.itemName, Op: "Query", Err: store.ErrInvalidFilter, Cause: err}
+		}
+		and = append(and, after)
 	}
 
-	objID, _ := primitive.ObjectIDFromHex(string(id))
+	sortDoc := bson.D{}
+	for _, key := range q.SortKeys() {
+		path, _ := sortPath(s.itemType, key.Field)
+		order := 1
+		if key.Desc {
+			order = -1
+		}
+		sortDoc = append(sortDoc, bson.E{Key: path, Value: order})
+	}
+	findOptions := options.Find().SetSort(sortDoc)
+	if q.Limit > 0 {
+		findOptions.SetLimit(int64(q.Limit) + 1) //one more to know if there is a next page
+	}
 
-	//make copy of old item
-	{
-		insertResult, err := s.collection.InsertOne(
-			ctx,
-			bson.M{
-				//"_id": a new _id is assigned by mongo and is different from actual item id
-				"rev":  oldInfo.Rev,
-				"id":   objID, //store actual item id of current rev that becomes latest rev below
-				"ts":   oldInfo.Timestamp,
-				"user": oldInfo.UserID,
-				"data": oldData,
-			})
-		if err != nil {
-			return store.ItemInfo{}, errors.Wrapf(err, "failed to make copy of old item")
+	cur, err := s.reads.Find(ctx, bson.M{"$and": and}, findOptions)
+	if err != nil {
+		return store.Page{}, s.error("Query", "", err)
+	}
+	defer cur.Close(ctx)
+
+	page := store.Page{
+		Items: make([]interface{}, 0),
+		Info:  make([]store.ItemInfo, 0),
+	}
+	for cur.Next(ctx) {
+		if q.Limit > 0 && len(page.Items) == q.Limit {
+			last := len(page.Items) - 1
+			page.Next = store.EncodeCursor(q.SortValues(page.Items[last], page.Info[last]))
+			break
+		}
+		docPtrValue := reflect.New(s.docType)
+		if err := cur.Decode(docPtrValue.Interface()); err != nil {
+			return store.Page{}, s.error("Query", "", err)
 		}
+		data, info := docItem(docPtrValue.Elem())
+		page.Items = append(page.Items, data)
+		page.Info = append(page.Info, info)
+	}
+	if err := cur.Err(); err != nil {
+		return store.Page{}, s.error("Query", "", err)
+	}
+	return page, nil
+} //mongoStore.Query()
+
+//Scan uses a mongo cursor to read items in batches while the caller iterates.
+//It is not limited by the operation timeout because a scan may run for long,
+//so only the caller's context stops it.
+func (s mongoStore) Scan(ctx context.Context, filter store.Filter) (store.IIterator, error) {
+	if err := filter.Validate(s.itemType); err != nil {
+		return nil, &store.Error{Store: s.itemName, Op: "Scan", Err: store.ErrInvalidFilter, Cause: err}
+	}
+	mongoKey, err := mongoFilter(s.itemType, filter)
+	if err != nil {
+		return nil, &store.Error{Store: s.itemName, Op: "Scan", Err: store.ErrInvalidFilter, Cause: err}
+	}
+	cur, err := s.reads.Find(ctx,
+		bson.M{"$and": bson.A{latestFilter, mongoKey}},
+		options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, s.error("Scan", "", err)
+	}
+	return &mongoIterator{s: s, ctx: ctx, cur: cur}, nil
+} //mongoStore.Scan()
+
+//mongoIterator iterates over a mongo cursor
+type mongoIterator struct {
+	s    mongoStore
+	ctx  context.Context
+	cur  *mongo.Cursor
+	data interface{}
+	info store.ItemInfo
+	err  error
+}
+
+func (it *mongoIterator) Next() bool {
+	if it.err == nil && it.ctx.Err() != nil {
+		it.err = it.s.error("Scan", "", it.ctx.Err())
+	}
+	if it.err != nil || !it.cur.Next(it.ctx) {
+		if it.err == nil && it.cur.Err() != nil {
+			it.err = it.s.error("Scan", "", it.cur.Err())
+		}
+		return false
+	}
+	docPtrValue := reflect.New(it.s.docType)
+	if err := it.cur.Decode(docPtrValue.Interface()); err != nil {
+		it.err = it.s.error("Scan", "", err)
+		return false
+	}
+	it.data, it.info = docItem(docPtrValue.Elem())
+	return true
+}
+
+func (it *mongoIterator) Item() (interface{}, store.ItemInfo) {
+	return it.data, it.info
+}
+
+func (it *mongoIterator) Err() error {
+	return it.err
+}
+
+func (it *mongoIterator) Close() error {
+	ctx, cancel := it.s.opContext(context.Background())
+	defer cancel()
+	return it.cur.Close(ctx)
+}
+
+func (s mongoStore) Count(ctx context.Context, filter store.Filter) (int, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if err := filter.Validate(s.itemType); err != nil {
+		return 0, &store.Error{Store: s.itemName, Op: "Count", Err: store.ErrInvalidFilter, Cause: err}
+	}
+	mongoKey, err := mongoFilter(s.itemType, filter)
+	if err != nil {
+		return 0, &store.Error{Store: s.itemName, Op: "Count", Err: store.ErrInvalidFilter, Cause: err}
+	}
+	n, err := s.reads.CountDocuments(ctx, bson.M{"$and": bson.A{latestFilter, mongoKey}})
+	if err != nil {
+		return 0, s.error("Count", "", err)
+	}
+	return int(n), nil
+} //mongoStore.Count()
+
+func (s mongoStore) Exists(ctx context.Context, id store.ID) (bool, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return false, nil //not a valid mongo id, so cannot exist
+	}
+	n, err := s.reads.CountDocuments(ctx, liveFilter(objID), options.Count().SetLimit(1))
+	if err != nil {
+		return false, s.error("Exists", id, err)
+	}
+	return n > 0, nil
+} //mongoStore.Exists()
+
+func (s mongoStore) Upd(ctx context.Context, id store.ID, newData interface{}) (store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
 
-		oid, ok := insertResult.InsertedID.(primitive.ObjectID)
-		if !ok {
-			return store.ItemInfo{}, errors.Wrapf(err, "failed to get inserted id of rev copy")
+	//retry when another update got in between until the context expires
+	for {
+		newInfo, err := s.upd(ctx, id, 0, newData)
+		if !stderrors.Is(err, store.ErrConflict) || ctx.Err() != nil {
+			return newInfo, err
 		}
-		log.Debugf("Bak %s:{id:\"%s\",rev:%d} (mongo:_id:%s)", s.itemName, oldInfo.ID, oldInfo.Rev, oid)
-	} //scope
+		log.Debugf("Retry upd %s:{id:\"%s\"}: %v", s.itemName, id, err)
+	}
+} //mongoStore.Upd()
+
+func (s mongoStore) UpdIf(ctx context.Context, id store.ID, expectedRev int, newData interface{}) (store.ItemInfo, error) {
+	if expectedRev < 1 {
+		return store.ItemInfo{}, &store.Error{Store: s.itemName, Op: "UpdIf", ID: id, Err: store.ErrInvalidValue, Cause: errors.Errorf("expectedRev=%d < 1", expectedRev)}
+	}
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+	return s.upd(ctx, id, expectedRev, newData)
+} //mongoStore.UpdIf()
+
+//upd creates a new revision if the latest is expectedRev, or any revision when expectedRev is 0
+//it fails with store.ConflictError if the latest revision changed since it was read
+func (s mongoStore) upd(ctx context.Context, id store.ID, expectedRev int, newData interface{}) (store.ItemInfo, error) {
+	op := "Upd"
+	if expectedRev != 0 {
+		op = "UpdIf"
+	}
+	newData, err := store.CheckValue(s.itemType, newData)
+	if err != nil {
+		return store.ItemInfo{}, s.error(op, id, err)
+	}
+
+	//get current item with header info
+	oldData, oldInfo, err := s.get(ctx, s.collection, id)
+	if err != nil {
+		return store.ItemInfo{}, s.error(op, id, err)
+	}
+	if expectedRev != 0 && oldInfo.Rev != expectedRev {
+		return store.ItemInfo{}, s.error(op, id, store.ConflictError{ID: id, Rev: oldInfo.Rev, ExpectedRev: expectedRev})
+	}
+
+	return s.newRev(ctx, op, oldData, oldInfo, newData, false)
+} //mongoStore.upd()
+
+//newRev replaces the latest revision of an item with a new revision that
+//is deleted or not, and keeps a copy of the old revision, in a transaction
+//when the deployment supports it.
+//It fails with store.ConflictError if the latest revision is no longer oldInfo.Rev
+func (s mongoStore) newRev(ctx context.Context, op string, oldData interface{}, oldInfo store.ItemInfo, newData interface{}, deleted bool) (store.ItemInfo, error) {
+	id := oldInfo.ID
+	objID, err := s.objectID(op, id)
+	if err != nil {
+		return store.ItemInfo{}, err
+	}
 
-	//now update existing doc with latest data and new rev nr
 	newInfo := store.ItemInfo{
 		ID:        oldInfo.ID,
 		Rev:       oldInfo.Rev + 1,
 		Timestamp: time.Now().Truncate(time.Millisecond),
-		UserID:    "", //todo
+		UserID:    store.UserFromContext(ctx),
+		Deleted:   deleted,
 	}
-	_, err = s.collection.UpdateOne(ctx,
-		bson.M{"_id": objID}, //update this existing doc
-		bson.M{
-			"$set": bson.M{
-				//"_id" does not change
-				"rev": newInfo.Rev,
-				//"id": not set on latest revision, because not known when added, so keep consistent
-				"ts":   newInfo.Timestamp,
-				"user": newInfo.UserID,
-				"data": newData,
-			},
-		})
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		//first make a copy of the old revision, so that a failure before the
+		//update leaves a copy at the latest rev, which history() ignores,
+		//rather than an update without a copy of the revision it replaced.
+		//the upsert does nothing when a copy of the rev was already made,
+		//e.g. by a concurrent update or a failed attempt.
+		copyResult, err := s.copies.UpdateOne(ctx,
+			bson.M{"id": objID, "rev": oldInfo.Rev},
+			bson.M{"$setOnInsert": bson.M{
+				//"_id": a new _id is assigned by mongo and is different from actual item id
+				"rev":     oldInfo.Rev,
+				"id":      objID, //store actual item id of the revision being replaced
+				"ts":      oldInfo.Timestamp,
+				"user-id": string(oldInfo.UserID),
+				"deleted": oldInfo.Deleted,
+				"data":    oldData,
+			}},
+			options.Update().SetUpsert(true))
+		if err != nil && !stderrors.Is(errorKind(err), store.ErrDuplicate) {
+			return err
+		}
+		if copyResult != nil && copyResult.UpsertedID != nil {
+			log.Debugf("Bak %s:{id:\"%s\",rev:%d} (mongo:_id:%s)", s.itemName, oldInfo.ID, oldInfo.Rev, copyResult.UpsertedID)
+		}
+
+		//update existing doc with latest data and new rev nr
+		//only if it is still at the rev that was read
+		updResult, err := s.collection.UpdateOne(ctx,
+			bson.M{"_id": objID, "rev": oldInfo.Rev}, //update this existing doc
+			bson.M{
+				"$set": bson.M{
+					//"_id" does not change
+					"rev": newInfo.Rev,
+					//"id": not set on latest revision, because not known when added, so keep consistent
+					"ts":      newInfo.Timestamp,
+					"user-id": string(newInfo.UserID),
+					"deleted": newInfo.Deleted,
+					"data":    newData,
+				},
+			})
+		if err != nil {
+			return err
+		}
+		if updResult.MatchedCount == 0 {
+			//read the head also when deleted, to report the rev it is at now
+			//the copy is kept after a conflict, because a concurrent update that
+			//won may rely on it, and history() ignores a copy at the latest rev
+			head := docHead{}
+			if err := s.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&head); err != nil {
+				if err == mongo.ErrNoDocuments && !s.transactions {
+					s.removeOrphanCopies(ctx, []primitive.ObjectID{objID})
+				}
+				return err
+			}
+			return store.ConflictError{ID: id, Rev: head.Rev, ExpectedRev: oldInfo.Rev} //also aborts the transaction
+		}
+		return nil
+	})
 	if err != nil {
-		return store.ItemInfo{}, errors.Wrapf(err, "failed to upd rev=%d of id=%s: %v", newInfo.Rev, id, err)
+		return store.ItemInfo{}, s.error(op, id, err)
+	}
+	log.Debugf("%s %s:{id:\"%s\",rev:%d}", op, s.itemName, newInfo.ID, newInfo.Rev)
+
+	//the update succeeded, so failing to remove old revisions is only logged
+	if _, err := s.retain(ctx, objID, newInfo.Timestamp); err != nil {
+		log.Errorf("failed to apply retention to %s:{id:\"%s\"}: %v", s.itemName, id, err)
 	}
-	log.Debugf("Upd %s:{id:\"%s\",rev:%d}", s.itemName, newInfo.ID, newInfo.Rev)
 	return newInfo, nil
-} //mongoStore.Upd()
+} //mongoStore.newRev()
 
-func (s mongoStore) Del(id store.ID) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//removeOrphanCopies deletes the copies of items that no longer exist, which
+//an update makes when the item is purged after it was read. Copies of items
+//that exist are never deleted after a failed update, because a concurrent
+//update that succeeded may rely on the copy it did not make.
+//Failures are only logged, because a purge also deletes the copies.
+func (s mongoStore) removeOrphanCopies(ctx context.Context, objIDs []primitive.ObjectID) {
+	cur, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": objIDs}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		log.Errorf("failed to find %s items to remove orphan copies: %v", s.itemName, err)
+		return
+	}
+	defer cur.Close(ctx)
+	exists := map[primitive.ObjectID]bool{}
+	for cur.Next(ctx) {
+		head := struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}{}
+		if err := cur.Decode(&head); err != nil {
+			log.Errorf("failed to decode %s item: %v", s.itemName, err)
+			return
+		}
+		exists[head.ID] = true
+	}
+	if err := cur.Err(); err != nil {
+		log.Errorf("failed to find %s items to remove orphan copies: %v", s.itemName, err)
+		return
+	}
+	orphans := bson.A{}
+	for _, objID := range objIDs {
+		if !exists[objID] {
+			orphans = append(orphans, objID)
+		}
+	}
+	if len(orphans) == 0 {
+		return
+	}
+	result, err := s.copies.DeleteMany(ctx, bson.M{"id": bson.M{"$in": orphans}})
+	if err != nil {
+		log.Errorf("failed to remove orphan copies of %d %s items: %v", len(orphans), s.itemName, err)
+		return
+	}
+	log.Debugf("Removed %d orphan copies of %d purged %s items", result.DeletedCount, len(orphans), s.itemName)
+} //mongoStore.removeOrphanCopies()
+
+//retain deletes the older revision copies of an item that are not kept
+//by the retention policy and returns the nr of revisions deleted
+func (s mongoStore) retain(ctx context.Context, objID primitive.ObjectID, now time.Time) (int, error) {
+	if s.retention.IsZero() {
+		return 0, nil
+	}
+	_, infoArray, err := s.history(ctx, store.ID(objID.Hex()), false)
+	if err != nil {
+		return 0, err
+	}
+	revs := bson.A{}
+	for i, keep := range s.retention.Keep(infoArray, now) {
+		if !keep {
+			revs = append(revs, infoArray[i].Rev)
+		}
+	}
+	if len(revs) == 0 {
+		return 0, nil
+	}
+	delResult, err := s.copies.DeleteMany(ctx, bson.M{"id": objID, "rev": bson.M{"$in": revs}})
+	if err != nil {
+		return 0, err
+	}
+	log.Debugf("Deleted %d old revisions of %s:{id:\"%s\"}", delResult.DeletedCount, s.itemName, objID.Hex())
+	return int(delResult.DeletedCount), nil
+} //mongoStore.retain()
+
+//Compact applies the retention policy to all items that have older revisions.
+//Each item is limited by the operation timeout rather than the whole compaction,
+//because it may run for long, so only the caller's context stops it.
+func (s mongoStore) Compact(ctx context.Context) (int, error) {
+	if s.retention.IsZero() {
+		return 0, nil
+	}
+	//group the copies by item with a cursor, because distinct returns
+	//all the ids in one document, which is limited to 16MB.
+	//the cursor runs as long as the caller allows, with each item
+	//limited to the operation timeout
+	cursor, err := s.copies.Aggregate(ctx,
+		bson.A{
+			bson.M{"$match": bson.M{"id": bson.M{"$ne": primitive.ObjectID{}}}},
+			bson.M{"$group": bson.M{"_id": "$id"}},
+		},
+		options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, s.error("Compact", "", err)
+	}
+	defer cursor.Close(context.Background())
+
+	n := 0
+	nrItems := 0
+	now := time.Now()
+	for cursor.Next(ctx) {
+		var group struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return n, s.error("Compact", "", err)
+		}
+		nrItems++
+		opCtx, cancel := s.opContext(ctx)
+		removed, err := s.retain(opCtx, group.ID, now)
+		cancel()
+		if err != nil {
+			return n, s.error("Compact", store.ID(group.ID.Hex()), err)
+		}
+		n += removed
+	}
+	if err := cursor.Err(); err != nil {
+		return n, s.error("Compact", "", err)
+	}
+	log.Debugf("Compacted %d old revisions of %d %s items", n, nrItems, s.itemName)
+	return n, nil
+} //mongoStore.Compact()
+
+func (s mongoStore) Del(ctx context.Context, id store.ID) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+	if s.softDelete {
+		return s.softDel(ctx, "Del", id)
+	}
+	return s.purge(ctx, "Del", id)
+}
+
+//softDel writes a tombstone revision with the last data,
+//retrying when another update got in between
+func (s mongoStore) softDel(ctx context.Context, op string, id store.ID) error {
+	for {
+		oldData, oldInfo, err := s.get(ctx, s.collection, id)
+		if stderrors.Is(err, store.ErrNotFound) {
+			return nil //nothing to delete
+		}
+		if err != nil {
+			return s.error(op, id, err)
+		}
+		_, err = s.newRev(ctx, op, oldData, oldInfo, oldData, true)
+		if !stderrors.Is(err, store.ErrConflict) || ctx.Err() != nil {
+			return err
+		}
+		log.Debugf("Retry del %s:{id:\"%s\"}: %v", s.itemName, id, err)
+	}
+} //mongoStore.softDel()
+
+func (s mongoStore) Undelete(ctx context.Context, id store.ID) (store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
 	defer cancel()
 
-	objID, _ := primitive.ObjectIDFromHex(string(id))
+	objID, err := s.objectID("Undelete", id)
+	if err != nil {
+		return store.ItemInfo{}, err
+	}
+	for {
+		docPtrValue := reflect.New(s.docType)
+		err := s.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(docPtrValue.Interface())
+		if err != nil {
+			return store.ItemInfo{}, s.error("Undelete", id, err)
+		}
+		data, info := docItem(docPtrValue.Elem())
+		if !info.Deleted {
+			return info, nil
+		}
+		newInfo, err := s.newRev(ctx, "Undelete", data, info, data, false)
+		if !stderrors.Is(err, store.ErrConflict) || ctx.Err() != nil {
+			return newInfo, err
+		}
+		log.Debugf("Retry undelete %s:{id:\"%s\"}: %v", s.itemName, id, err)
+	}
+} //mongoStore.Undelete()
+
+func (s mongoStore) Purge(ctx context.Context, id store.ID) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+	return s.purge(ctx, "Purge", id)
+}
 
-	//delete the latest revision
-	delResult, err := s.collection.DeleteOne(ctx, bson.M{"_id": objID})
+//purge deletes the latest and all older revisions of an item
+func (s mongoStore) purge(ctx context.Context, op string, id store.ID) error {
+	objID, err := s.objectID(op, id)
+	if err != nil {
+		return nil //nothing to delete
+	}
+
+	//mark and delete the latest revision
+	err = s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.markPurged(ctx, bson.A{objID}); err != nil {
+			return err
+		}
+		delResult, err := s.collection.DeleteOne(ctx, bson.M{"_id": objID})
+		if err != nil {
+			return err
+		}
+		log.Debugf("Deleted %d documents for %s:{id:\"%s\"}", delResult.DeletedCount, s.itemName, id)
+		return nil
+	})
 	if err != nil {
-		return errors.Wrapf(err, "failed to delete latest rev of id=%s: %v", id, err)
+		return s.error(op, id, err)
 	}
-	log.Debugf("Deleted %d documents for %s:{id:\"%s\"}", delResult.DeletedCount, s.itemName, id)
 
 	//delete the older revisions
-	delResult, err = s.collection.DeleteMany(ctx, bson.M{"id": objID})
+	delResult, err := s.copies.DeleteMany(ctx, bson.M{"id": objID})
 	if err != nil {
-		return errors.Wrapf(err, "failed to delete older rev of id=%s: %v", id, err)
+		return s.error(op, id, errors.Wrapf(err, "failed to delete older revisions"))
 	}
 	log.Debugf("Deleted %d old documents for %s:{id:\"%s\"}", delResult.DeletedCount, s.itemName, id)
 
 	return nil
-} //mongoStore.Del()
+} //mongoStore.purge()
+
+func (s mongoStore) AddMany(ctx context.Context, values []interface{}) ([]store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if len(values) == 0 {
+		return []store.ItemInfo{}, nil
+	}
+
+	//assign the _id of each doc here, so the results can be mapped
+	//to the values when only some of them were inserted
+	ts := time.Now().Truncate(time.Millisecond)
+	user := store.UserFromContext(ctx)
+	infoArray := make([]store.ItemInfo, len(values))
+	errs := make([]error, len(values))
+	docs := make([]interface{}, 0, len(values))
+	docIndex := make([]int, 0, len(values)) //index in values of each doc
+	for i, v := range values {
+		v, err := store.CheckValue(s.itemType, v)
+		if err != nil {
+			errs[i] = s.error("AddMany", "", err)
+			continue
+		}
+		objID := primitive.NewObjectID()
+		infoArray[i] = store.ItemInfo{ID: store.ID(objID.Hex()), Rev: 1, Timestamp: ts, UserID: user}
+		docIndex = append(docIndex, i)
+		docs = append(docs, bson.M{
+			"_id":     objID,
+			"rev":     1,
+			"id":      primitive.ObjectID{},
+			"ts":      ts,
+			"user-id": string(user),
+			"deleted": false,
+			"data":    v,
+		})
+	}
+	if len(docs) == 0 {
+		return infoArray, store.NewBatchError(errs)
+	}
+	_, err := s.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		bulkErr, ok := err.(mongo.BulkWriteException)
+		if !ok || len(bulkErr.WriteErrors) == 0 {
+			return nil, s.error("AddMany", "", err)
+		}
+		for _, we := range bulkErr.WriteErrors {
+			if we.Index >= 0 && we.Index < len(docIndex) {
+				i := docIndex[we.Index]
+				errs[i] = s.error("AddMany", "", mongo.WriteException{WriteErrors: mongo.WriteErrors{we.WriteError}})
+				infoArray[i] = store.ItemInfo{}
+			}
+		}
+		return infoArray, store.NewBatchError(errs)
+	}
+	log.Debugf("Added %d %s items", len(docs), s.itemName)
+	return infoArray, store.NewBatchError(errs)
+} //mongoStore.AddMany()
+
+func (s mongoStore) GetMany(ctx context.Context, ids []store.ID) ([]interface{}, []store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+	return s.getMany(ctx, s.reads, "GetMany", ids)
+}
+
+//getMany returns the latest revision of each item in ids in the same order,
+//with store.ErrNotFound in the *store.BatchError for items that do not exist,
+//from the collection, which is s.collection to read from the primary before an update
+func (s mongoStore) getMany(ctx context.Context, collection *mongo.Collection, op string, ids []store.ID) ([]interface{}, []store.ItemInfo, error) {
+	dataArray := make([]interface{}, len(ids))
+	infoArray := make([]store.ItemInfo, len(ids))
+	errs := make([]error, len(ids))
+	objIDs := bson.A{}
+	for i, id := range ids {
+		objID, err := s.objectID(op, id)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		objIDs = append(objIDs, objID)
+	}
+
+	found := map[store.ID]int{}
+	if len(objIDs) > 0 {
+		cur, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": objIDs}, "deleted": bson.M{"$ne": true}})
+		if err != nil {
+			return nil, nil, s.error(op, "", err)
+		}
+		defer cur.Close(ctx)
+		for cur.Next(ctx) {
+			docPtrValue := reflect.New(s.docType)
+			if err := cur.Decode(docPtrValue.Interface()); err != nil {
+				return nil, nil, s.error(op, "", err)
+			}
+			data, info := docItem(docPtrValue.Elem())
+			for i, id := range ids {
+				if id == info.ID {
+					dataArray[i] = data
+					infoArray[i] = info
+					found[id]++
+				}
+			}
+		}
+		if err := cur.Err(); err != nil {
+			return nil, nil, s.error(op, "", err)
+		}
+	}
+
+	for i, id := range ids {
+		if errs[i] == nil && found[id] == 0 {
+			errs[i] = s.error(op, id, mongo.ErrNoDocuments)
+		}
+	}
+	return dataArray, infoArray, store.NewBatchError(errs)
+} //mongoStore.getMany()
+
+//UpdMany makes copies of the old revisions, then updates all items in one
+//bulk write, without a transaction so that items can fail independently.
+//Items that were updated by someone else after they were read fail with
+//store.ErrConflict.
+func (s mongoStore) UpdMany(ctx context.Context, ids []store.ID, values []interface{}) ([]store.ItemInfo, error) {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if len(ids) != len(values) {
+		return nil, &store.Error{Store: s.itemName, Op: "UpdMany", Err: store.ErrInvalidValue, Cause: errors.Errorf("%d ids != %d values", len(ids), len(values))}
+	}
+	if len(ids) == 0 {
+		return []store.ItemInfo{}, nil
+	}
+
+	oldData, oldInfo, err := s.getMany(ctx, s.collection, "UpdMany", ids)
+	if _, ok := err.(*store.BatchError); err != nil && !ok {
+		return nil, err
+	}
+	errs := store.BatchErrors(err, len(ids))
+	newData := make([]interface{}, len(ids))
+	for i, id := range ids {
+		if errs[i] == nil {
+			if newData[i], err = store.CheckValue(s.itemType, values[i]); err != nil {
+				errs[i] = s.error("UpdMany", id, err)
+			}
+		}
+	}
+
+	ts := time.Now().Truncate(time.Millisecond)
+	user := store.UserFromContext(ctx)
+	newInfo := make([]store.ItemInfo, len(ids))
+	models := []mongo.WriteModel{}
+	modelIndex := []int{} //index in ids of each model
+	for i := range ids {
+		if errs[i] != nil {
+			continue
+		}
+		objID, _ := primitive.ObjectIDFromHex(string(ids[i]))
+		newInfo[i] = store.ItemInfo{ID: ids[i], Rev: oldInfo[i].Rev + 1, Timestamp: ts, UserID: user}
+		modelIndex = append(modelIndex, i)
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": objID, "rev": oldInfo[i].Rev}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"rev":     newInfo[i].Rev,
+				"ts":      ts,
+				"user-id": string(user),
+				"deleted": false,
+				"data":    newData[i],
+			}}))
+	}
+	if len(models) == 0 {
+		return newInfo, store.NewBatchError(errs)
+	}
+
+	//first make copies of the old revisions, like newRev() does,
+	//which are kept also for items that are not updated below
+	copyModels := make([]mongo.WriteModel, len(modelIndex))
+	for m, i := range modelIndex {
+		objID, _ := primitive.ObjectIDFromHex(string(ids[i]))
+		copyModels[m] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"id": objID, "rev": oldInfo[i].Rev}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{
+				"rev":     oldInfo[i].Rev,
+				"id":      objID,
+				"ts":      oldInfo[i].Timestamp,
+				"user-id": string(oldInfo[i].UserID),
+				"deleted": oldInfo[i].Deleted,
+				"data":    oldData[i],
+			}}).
+			SetUpsert(true)
+	}
+	_, err = s.copies.BulkWrite(ctx, copyModels, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		//concurrent upserts of the same copy fail on the unique id+rev index
+		if bulkErr, ok := err.(mongo.BulkWriteException); !ok || bulkErr.WriteConcernError != nil || !isDuplicatesOnly(bulkErr) {
+			return nil, s.error("UpdMany", "", err)
+		}
+	}
+	result, err := s.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		//items that failed, e.g. on a unique index, fail without failing the others
+		bulkErr, ok := err.(mongo.BulkWriteException)
+		if !ok || len(bulkErr.WriteErrors) == 0 || bulkErr.WriteConcernError != nil {
+			return nil, s.error("UpdMany", "", err)
+		}
+		for _, we := range bulkErr.WriteErrors {
+			if we.Index >= 0 && we.Index < len(modelIndex) {
+				i := modelIndex[we.Index]
+				errs[i] = s.error("UpdMany", ids[i], mongo.WriteException{WriteErrors: mongo.WriteErrors{we.WriteError}})
+				newInfo[i] = store.ItemInfo{}
+			}
+		}
+	}
+
+	//when not all matched, read the revs to see which ones were updated by someone else
+	if int(result.MatchedCount) < len(models) {
+		_, latestInfo, err := s.getMany(ctx, s.collection, "UpdMany", ids)
+		if _, ok := err.(*store.BatchError); err != nil && !ok {
+			return nil, err
+		}
+		latestErrs := store.BatchErrors(err, len(ids))
+		for i, id := range ids {
+			if errs[i] != nil {
+				continue
+			}
+			if latestErrs[i] != nil {
+				errs[i] = latestErrs[i]
+			} else if latestInfo[i].Rev != newInfo[i].Rev || !latestInfo[i].Timestamp.Equal(ts) {
+				errs[i] = s.error("UpdMany", id, store.ConflictError{ID: id, Rev: latestInfo[i].Rev, ExpectedRev: oldInfo[i].Rev})
+			}
+			if errs[i] != nil {
+				newInfo[i] = store.ItemInfo{}
+			}
+		}
+	}
+
+	notFound := []primitive.ObjectID{}
+	for _, i := range modelIndex {
+		objID, _ := primitive.ObjectIDFromHex(string(ids[i]))
+		if errs[i] == nil {
+			if _, err := s.retain(ctx, objID, ts); err != nil {
+				log.Errorf("failed to apply retention to %s:{id:\"%s\"}: %v", s.itemName, ids[i], err)
+			}
+		} else if stderrors.Is(errs[i], store.ErrNotFound) {
+			notFound = append(notFound, objID)
+		}
+	}
+	if len(notFound) > 0 {
+		s.removeOrphanCopies(ctx, notFound)
+	}
+	log.Debugf("Upd %d of %d %s items", result.ModifiedCount, len(ids), s.itemName)
+	return newInfo, store.NewBatchError(errs)
+} //mongoStore.UpdMany()
+
+func (s mongoStore) DelMany(ctx context.Context, ids []store.ID) error {
+	ctx, cancel := s.opContext(ctx)
+	defer cancel()
+
+	if s.softDelete {
+		//each tombstone is a conditional update, so cannot be done in bulk
+		errs := make([]error, len(ids))
+		for i, id := range ids {
+			errs[i] = s.softDel(ctx, "DelMany", id)
+		}
+		return store.NewBatchError(errs)
+	}
+
+	objIDs := bson.A{}
+	for _, id := range ids {
+		if objID, err := primitive.ObjectIDFromHex(string(id)); err == nil {
+			objIDs = append(objIDs, objID)
+		}
+	}
+	if len(objIDs) == 0 {
+		return nil //nothing to delete
+	}
+
+	var delResult *mongo.DeleteResult
+	err := s.transaction(ctx, func(ctx context.Context) error {
+		if err := s.markPurged(ctx, objIDs); err != nil {
+			return err
+		}
+		var err error
+		delResult, err = s.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": objIDs}})
+		return err
+	})
+	if err != nil {
+		return s.error("DelMany", "", err)
+	}
+	log.Debugf("Deleted %d documents for %d %s items", delResult.DeletedCount, len(ids), s.itemName)
+
+	delResult, err = s.copies.DeleteMany(ctx, bson.M{"id": bson.M{"$in": objIDs}})
+	if err != nil {
+		return s.error("DelMany", "", errors.Wrapf(err, "failed to delete older revisions"))
+	}
+	log.Debugf("Deleted %d old documents for %d %s items", delResult.DeletedCount, len(ids), s.itemName)
+	return nil
+} //mongoStore.DelMany()
 
 // func (f factory) GetMsisdn(msisdn string) users.IUser {
 // 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -361,10 +1430,40 @@ type docHead struct {
 	Rev       int                `bson:"rev" doc:"Revision number"`
 	ItemID    primitive.ObjectID `bson:"id" doc:"Item _id of the latest version (never changes)"`
 	Timestamp time.Time          `bson:"ts" doc:"Timestamp when this revision was created."`
-	UserID    primitive.ObjectID `bson:"user-id" doc:"User _id who created this."`
+	UserID    string             `bson:"user-id" doc:"User id who created this revision."`
+	Deleted   bool               `bson:"deleted" doc:"True on the tombstone revision of a soft deleted item."`
 	//Data follows but not part of head
 }
 
+//info returns the item info in the head of a document
+//using the id of the latest revision for older revision copies
+func (head docHead) info() store.ItemInfo {
+	id := head.ID
+	if !head.ItemID.IsZero() {
+		id = head.ItemID
+	}
+	return store.ItemInfo{
+		ID:        store.ID(id.Hex()),
+		Rev:       head.Rev,
+		Timestamp: head.Timestamp,
+		UserID:    store.ID(head.UserID),
+		Deleted:   head.Deleted,
+	}
+}
+
+//docItem returns the user data and item info from a value of docType()
+func docItem(docValue reflect.Value) (interface{}, store.ItemInfo) {
+	head := docHead{
+		ID:        docValue.Field(IDFieldIndex).Interface().(primitive.ObjectID),
+		Rev:       docValue.Field(RevFieldIndex).Interface().(int),
+		ItemID:    docValue.Field(ItemIDFieldIndex).Interface().(primitive.ObjectID),
+		Timestamp: docValue.Field(TimestampFieldIndex).Interface().(time.Time),
+		UserID:    docValue.Field(UserIDFieldIndex).Interface().(string),
+		Deleted:   docValue.Field(DeletedFieldIndex).Interface().(bool),
+	}
+	return docValue.Field(DataFieldIndex).Interface(), head.info()
+}
+
 //docType() is the complete struct type of each mongo doc
 //it is same as struct{docHead, data:<user type>}:
 //
@@ -373,8 +1472,9 @@ type docHead struct {
 //	[1]  "rev"     int            is revision nr 1,2,3,...
 //	[2]  "item-id" string         is set when preserving old revision, copying the _id if the original item
 //	[3]  "ts"      time.Time      is the timestamp when this revision was created
-//	[4]  "user-id" string         is the user _id
-//	[5]  "data"    <user type>    is the data struct stored for user data of this item
+//	[4]  "user-id" string         is the user id from store.WithUser()
+//	[5]  "deleted" bool           is true on the tombstone revision of a soft deleted item
+//	[6]  "data"    <user type>    is the data struct stored for user data of this item
 const (
 	//IDFieldIndex ...
 	IDFieldIndex = 0
@@ -386,11 +1486,12 @@ const (
 	TimestampFieldIndex = 3
 	//UserIDFieldIndex ...
 	UserIDFieldIndex = 4
+	//DeletedFieldIndex ...
+	DeletedFieldIndex = 5
 	//DataFieldIndex ...
-	DataFieldIndex = 5
+	DataFieldIndex = 6
 
 	//todo: also add user and timestamp for each rev...
-	//todo: limit nr of rev that is kept (default: unlimited)
 	//todo: user data key combinations
 )
 
@@ -1,10 +1,15 @@
 package mongo_test
 
 import (
+	"context"
+	"net/url"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/go-msvc/store"
 	"github.com/go-msvc/store/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func Test1(t *testing.T) {
@@ -12,3 +17,134 @@ func Test1(t *testing.T) {
 		Database: "test",
 	})
 }
+
+func TestSoftDelete(t *testing.T) {
+	store.DoStoreTest(t, mongo.Config{
+		Database:   "test",
+		SoftDelete: true,
+	})
+}
+
+func TestSeparateHistory(t *testing.T) {
+	store.DoStoreTest(t, mongo.Config{
+		Database:        "test",
+		SeparateHistory: true,
+	})
+}
+
+func TestMigrateHistory(t *testing.T) {
+	type note struct {
+		Text string
+	}
+	mixed, err := mongo.Config{Database: "test"}.New("test_migrate", reflect.TypeOf(note{}))
+	if err != nil {
+		t.Fatalf("failed to create store: %+v", err)
+	}
+	info, err := mixed.Add(note{Text: "a"})
+	if err != nil {
+		t.Fatalf("failed to add: %+v", err)
+	}
+	for _, text := range []string{"b", "c"} {
+		if _, err := mixed.Upd(info.ID, note{Text: text}); err != nil {
+			t.Fatalf("failed to upd: %+v", err)
+		}
+	}
+
+	c := mongo.Config{Database: "test", SeparateHistory: true}
+	if n, err := mongo.MigrateHistory(context.Background(), c, "test_migrate"); err != nil || n < 2 {
+		t.Fatalf("moved %d revisions, err=%+v", n, err)
+	}
+	separate, err := c.New("test_migrate", reflect.TypeOf(note{}))
+	if err != nil {
+		t.Fatalf("failed to create store: %+v", err)
+	}
+	defer separate.Purge(info.ID)
+	values, revs, err := separate.GetHistory(info.ID)
+	if err != nil || len(revs) != 3 || values[0].(note).Text != "a" || values[2].(note).Text != "c" {
+		t.Fatalf("history after migration %+v %+v, err=%+v", values, revs, err)
+	}
+}
+
+func TestFromURL(t *testing.T) {
+	tests := []struct {
+		url        string
+		uri        string
+		database   string
+		softDelete bool
+		noIndexes  bool
+	}{
+		{"mongo://localhost:27017/mydb", "mongodb://localhost:27017/", "mydb", false, false},
+		{"mongo://u:p@h1,h2:27018/db?replicaSet=rs0", "mongodb://u:p@h1,h2:27018/?replicaSet=rs0", "db", false, false},
+		{"mongo+srv://cluster.example.com/db", "mongodb+srv://cluster.example.com/", "db", false, false},
+		{"mongo://localhost/db?replicaSet=rs0&softDelete=true", "mongodb://localhost/?replicaSet=rs0", "db", true, false},
+		{"mongo://localhost/db?noIndexes=true&w=majority", "mongodb://localhost/?w=majority", "db", false, true},
+		{"mongo://localhost/db?separateHistory=true", "mongodb://localhost/", "db", false, false},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		c, err := mongo.Config{}.FromURL(u)
+		if err != nil {
+			t.Fatalf("%s failed: %+v", test.url, err)
+		}
+		mc := c.(mongo.Config)
+		if mc.URI != test.uri || mc.Database != test.database || mc.SoftDelete != test.softDelete || mc.NoIndexes != test.noIndexes {
+			t.Fatalf("%s -> %+v", test.url, mc)
+		}
+	}
+
+	u, _ := url.Parse("mongo://localhost/db?separateHistory=true")
+	if c, err := (mongo.Config{}).FromURL(u); err != nil || !c.(mongo.Config).SeparateHistory {
+		t.Fatalf("separateHistory not set: %+v, err=%v", c, err)
+	}
+
+	u, _ = url.Parse("mongo://localhost:27017")
+	if _, err := (mongo.Config{}).FromURL(u); err == nil {
+		t.Fatalf("accepted URL without database")
+	}
+}
+
+func TestValueStructs(t *testing.T) {
+	//structs with unexported fields from the driver are stored as one value
+	type payment struct {
+		Amount primitive.Decimal128
+		Link   *url.URL
+	}
+	if err := store.ValidateUserType(reflect.TypeOf(payment{})); err != nil {
+		t.Fatalf("cannot store %T: %+v", payment{}, err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		config mongo.Config
+		ok     bool
+	}{
+		{mongo.Config{Database: "test"}, true},
+		{mongo.Config{}, false},
+		{mongo.Config{Database: "test", WriteConcern: "majority", Journal: true, WriteTimeout: time.Second, ReadConcern: "majority", ReadPreference: "secondaryPreferred", MaxStaleness: 90 * time.Second}, true},
+		{mongo.Config{Database: "test", WriteConcern: "2"}, true},
+		{mongo.Config{Database: "test", WriteConcern: "-1"}, false},
+		{mongo.Config{Database: "test", WriteConcern: "0"}, false},
+		{mongo.Config{URI: "mongodb://localhost/?w=0", Database: "test"}, false},
+		{mongo.Config{Database: "test", WriteConcern: "0", ReadConcern: "available"}, false},
+		{mongo.Config{Database: "test", ReadConcern: "linearizable"}, true},
+		{mongo.Config{Database: "test", ReadConcern: "most"}, false},
+		{mongo.Config{Database: "test", ReadPreference: "secondaries"}, false},
+		{mongo.Config{Database: "test", MaxStaleness: time.Minute}, false},
+		{mongo.Config{Database: "test", ReadPreference: "primary", MaxStaleness: time.Minute}, false},
+		{mongo.Config{Database: "test", MaxPoolSize: 10, MinPoolSize: 2}, true},
+		{mongo.Config{Database: "test", MaxPoolSize: 2, MinPoolSize: 10}, false},
+		{mongo.Config{Database: "test", OpTimeout: -time.Second}, false},
+		{mongo.Config{Database: "test", Username: "u", Password: "p", AuthSource: "admin", AppName: "test"}, true},
+		{mongo.Config{Database: "test", Password: "p"}, false},
+		{mongo.Config{Database: "test", TLS: true}, true},
+		{mongo.Config{Database: "test", TLSCertFile: "cert.pem"}, false},
+		{mongo.Config{Database: "test", TLSCAFile: "missing.pem"}, false},
+	}
+	for i, test := range tests {
+		err := test.config.Validate()
+		if (err == nil) != test.ok {
+			t.Fatalf("test[%d]: %+v -> err=%v", i, test.config, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+//transactionOptions are used instead of the concerns in Config, some of which,
+//e.g. ReadConcern "available" or "linearizable", cannot be used in transactions
+var transactionOptions = options.Transaction().
+	SetReadConcern(readconcern.Snapshot()).
+	SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+
+//supportsTransactions is true when the deployment is a replica set of mongo 4.0+
+//or a sharded cluster of mongo 4.2+, where multi-document transactions can be used
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	result := struct {
+		SetName        string `bson:"setName"`
+		Msg            string `bson:"msg"`
+		MaxWireVersion int    `bson:"maxWireVersion"`
+	}{}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&result); err != nil {
+		return false
+	}
+	return (len(result.SetName) > 0 && result.MaxWireVersion >= 7) ||
+		(result.Msg == "isdbgrid" && result.MaxWireVersion >= 8)
+}
+
+//transaction runs fn in a multi-document transaction when the deployment
+//supports it, so that either all or none of its writes are done, else it
+//just runs fn and the writes must be ordered so that a failure after any
+//of them leaves consistent data
+func (s mongoStore) transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.transactions {
+		return fn(ctx)
+	}
+	session, err := s.collection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	}, transactionOptions)
+	return err
+} //mongoStore.transaction()
@@ -0,0 +1,374 @@
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-msvc/log"
+	"github.com/go-msvc/store"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//defaultPollInterval is used when Config.WatchPollInterval is not set
+const defaultPollInterval = time.Second
+
+//purgedField is set to a purgeMark in the latest revision of an item just before
+//it is hard deleted, because the change stream delete event does not tell if the
+//deleted document was an item or an old revision copy, nor which revision it was
+const purgedField = "purged"
+
+//purgeMark tells the watchers which revision was deleted when and by whom
+type purgeMark struct {
+	Rev       int       `bson:"rev"`
+	Timestamp time.Time `bson:"ts"`
+	UserID    string    `bson:"user-id"`
+}
+
+//markPurged sets the purge mark in the latest revisions of the items that exist,
+//retrying for items that were updated after their revision was read
+func (s mongoStore) markPurged(ctx context.Context, objIDs bson.A) error {
+	ts := time.Now().Truncate(time.Millisecond)
+	user := string(store.UserFromContext(ctx))
+	for {
+		cur, err := s.collection.Find(ctx,
+			bson.M{"_id": bson.M{"$in": objIDs}, purgedField: bson.M{"$exists": false}},
+			options.Find().SetProjection(bson.M{"_id": 1, "rev": 1}))
+		if err != nil {
+			return err
+		}
+		models := []mongo.WriteModel{}
+		for cur.Next(ctx) {
+			head := docHead{}
+			if err := cur.Decode(&head); err != nil {
+				cur.Close(ctx)
+				return err
+			}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": head.ID, "rev": head.Rev}).
+				SetUpdate(bson.M{"$set": bson.M{purgedField: purgeMark{Rev: head.Rev, Timestamp: ts, UserID: user}}}))
+		}
+		err = cur.Err()
+		cur.Close(ctx)
+		if err != nil {
+			return err
+		}
+		if len(models) == 0 {
+			return nil
+		}
+		result, err := s.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		if int(result.MatchedCount) == len(models) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+} //mongoStore.markPurged()
+
+//Watch uses a change stream when the server supports it, i.e. on a replica set,
+//else it polls for revisions written after the last one it saw.
+//The change stream reports the hard deletes done by this package from the mark
+//set on the item before it is deleted, with the data when it could still be read,
+//and ignores other deletes, e.g. of old revisions.
+//Polling does not see hard deletes, and it pages by the revision timestamps,
+//which are set by the clients: it misses revisions written with a timestamp
+//before the last one it saw, i.e. by clients with clocks behind the others or
+//when revisions in the same millisecond are committed out of _id order.
+//Use a replica set when all changes must be seen.
+//Like Scan, it is not limited by the operation timeout.
+//Resume tokens start with "c" for change streams and "p" for polling.
+func (s mongoStore) Watch(ctx context.Context, filter store.Filter, resume string) (store.IWatcher, error) {
+	if err := filter.Validate(s.itemType); err != nil {
+		return nil, &store.Error{Store: s.itemName, Op: "Watch", Err: store.ErrInvalidFilter, Cause: err}
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	w := &mongoWatcher{s: s, parent: ctx, ctx: watchCtx, cancel: cancel, filter: filter}
+
+	switch {
+	case len(resume) == 0:
+		err := w.startStream(nil)
+		if err == nil {
+			return w, nil
+		}
+		if _, ok := err.(mongo.CommandError); !ok {
+			cancel()
+			return nil, s.error("Watch", "", err)
+		}
+		log.Debugf("Watch %s polling because change stream failed: %v", s.itemName, err)
+		w.poll = &pollPos{Timestamp: time.Now().Truncate(time.Millisecond)}
+		return w, nil
+
+	case resume[0] == 'c':
+		token, err := base64.RawURLEncoding.DecodeString(resume[1:])
+		if err == nil {
+			err = w.startStream(bson.Raw(token))
+		}
+		if err != nil {
+			cancel()
+			return nil, &store.Error{Store: s.itemName, Op: "Watch", Err: store.ErrExpired, Cause: err}
+		}
+		return w, nil
+
+	case resume[0] == 'p':
+		w.poll = &pollPos{}
+		jsonPos, err := base64.RawURLEncoding.DecodeString(resume[1:])
+		if err == nil {
+			err = json.Unmarshal(jsonPos, w.poll)
+		}
+		if err != nil {
+			cancel()
+			return nil, &store.Error{Store: s.itemName, Op: "Watch", Err: store.ErrExpired, Cause: err}
+		}
+		return w, nil
+	}
+	cancel()
+	return nil, &store.Error{Store: s.itemName, Op: "Watch", Err: store.ErrExpired, Cause: errors.Errorf("invalid resume token \"%s\"", resume)}
+} //mongoStore.Watch()
+
+//mongoWatcher reads either a change stream or polls when stream is nil
+//and the mutex is held while using the stream so Close() can wait for Next()
+type mongoWatcher struct {
+	s      mongoStore
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	mutex  sync.Mutex
+	filter store.Filter
+	stream *mongo.ChangeStream
+	poll   *pollPos
+	queue  []store.Change
+	change store.Change
+	err    error
+}
+
+//pollPos is the last revision seen when polling
+type pollPos struct {
+	Timestamp time.Time          `json:"ts"`
+	ID        primitive.ObjectID `json:"id"`
+}
+
+//changeEvent is the part of a change stream event that is used
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      bson.Raw `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields struct {
+			Purged *purgeMark `bson:"purged"`
+		} `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+func (w *mongoWatcher) startStream(resumeAfter bson.Raw) error {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeAfter != nil {
+		opts.SetResumeAfter(resumeAfter)
+	}
+	//skip inserts of old revision copies
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"$or": bson.A{
+		bson.M{"operationType": bson.M{"$ne": "insert"}},
+		bson.M{"fullDocument.id": primitive.ObjectID{}},
+	}}}}}
+	stream, err := w.s.collection.Watch(w.ctx, pipeline, opts)
+	if err != nil {
+		return err
+	}
+	w.stream = stream
+	return nil
+}
+
+func (w *mongoWatcher) Next() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for w.err == nil {
+		if w.ctx.Err() != nil {
+			//no error when stopped by Close()
+			if w.parent.Err() != nil {
+				w.err = w.s.error("Watch", "", w.parent.Err())
+			}
+			return false
+		}
+		if len(w.queue) > 0 {
+			w.change = w.queue[0]
+			w.queue = w.queue[1:]
+			return true
+		}
+		if w.stream != nil {
+			w.nextEvent()
+		} else {
+			w.nextPoll()
+		}
+	}
+	return false
+} //mongoWatcher.Next()
+
+//nextEvent waits for the next change stream event and queues it if it matches
+func (w *mongoWatcher) nextEvent() {
+	if !w.stream.Next(w.ctx) {
+		if w.stream.Err() != nil && w.ctx.Err() == nil {
+			w.err = w.s.error("Watch", "", w.stream.Err())
+		}
+		return
+	}
+	event := changeEvent{}
+	if err := w.stream.Decode(&event); err != nil {
+		w.err = w.s.error("Watch", "", err)
+		return
+	}
+	c := store.Change{Token: "c" + base64.RawURLEncoding.EncodeToString(w.stream.ResumeToken())}
+	switch event.OperationType {
+	case "insert", "update", "replace":
+		if mark := event.UpdateDescription.UpdatedFields.Purged; mark != nil {
+			//with the data unless it was already deleted when looked up
+			if event.FullDocument != nil && !w.decode(&c, event.FullDocument) && w.err != nil {
+				return
+			}
+			c.Op = store.ChangeDel
+			c.Info = store.ItemInfo{
+				ID:        store.ID(event.DocumentKey.ID.Hex()),
+				Rev:       mark.Rev,
+				Timestamp: mark.Timestamp,
+				UserID:    store.ID(mark.UserID),
+				Deleted:   true,
+			}
+			break
+		}
+		if event.FullDocument == nil {
+			return //deleted before it was looked up
+		}
+		if !w.decode(&c, event.FullDocument) {
+			return
+		}
+		c.Op = changeOp(c.Info)
+	default:
+		return //e.g. delete, which was reported from the purge mark, drop or invalidate
+	}
+	w.push(c)
+} //mongoWatcher.nextEvent()
+
+//decode sets the change data and info from the document,
+//and is false on error or when the document is an old revision copy
+func (w *mongoWatcher) decode(c *store.Change, doc bson.Raw) bool {
+	docPtrValue := reflect.New(w.s.docType)
+	if err := bson.Unmarshal(doc, docPtrValue.Interface()); err != nil {
+		w.err = w.s.error("Watch", "", err)
+		return false
+	}
+	if !docPtrValue.Elem().Field(ItemIDFieldIndex).Interface().(primitive.ObjectID).IsZero() {
+		return false //old revision copy
+	}
+	c.Data, c.Info = docItem(docPtrValue.Elem())
+	return true
+} //mongoWatcher.decode()
+
+//nextPoll reads the revisions written after the last poll position
+//and waits for the poll interval when there are none
+func (w *mongoWatcher) nextPoll() {
+	ctx, cancel := w.s.opContext(w.ctx)
+	defer cancel()
+	cur, err := w.s.collection.Find(ctx,
+		bson.M{"id": primitive.ObjectID{}, "$or": bson.A{
+			bson.M{"ts": bson.M{"$gt": w.poll.Timestamp}},
+			bson.M{"ts": w.poll.Timestamp, "_id": bson.M{"$gt": w.poll.ID}},
+		}},
+		options.Find().SetSort(bson.D{{Key: "ts", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(100))
+	if err != nil {
+		if w.ctx.Err() == nil {
+			w.err = w.s.error("Watch", "", err)
+		}
+		return
+	}
+	defer cur.Close(ctx)
+	n := 0
+	for cur.Next(ctx) {
+		docPtrValue := reflect.New(w.s.docType)
+		if err := cur.Decode(docPtrValue.Interface()); err != nil {
+			w.err = w.s.error("Watch", "", err)
+			return
+		}
+		n++
+		c := store.Change{}
+		c.Data, c.Info = docItem(docPtrValue.Elem())
+		c.Op = changeOp(c.Info)
+		w.poll.Timestamp = docPtrValue.Elem().Field(TimestampFieldIndex).Interface().(time.Time)
+		w.poll.ID = docPtrValue.Elem().Field(IDFieldIndex).Interface().(primitive.ObjectID)
+		jsonPos, _ := json.Marshal(w.poll)
+		c.Token = "p" + base64.RawURLEncoding.EncodeToString(jsonPos)
+		w.push(c)
+	}
+	if err := cur.Err(); err != nil && w.ctx.Err() == nil {
+		w.err = w.s.error("Watch", "", err)
+		return
+	}
+	if n == 0 {
+		interval := w.s.watchPollInterval
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		select {
+		case <-w.ctx.Done():
+		case <-time.After(interval):
+		}
+	}
+} //mongoWatcher.nextPoll()
+
+//changeOp returns the kind of change that wrote the revision
+func changeOp(info store.ItemInfo) store.ChangeOp {
+	switch {
+	case info.Deleted:
+		return store.ChangeDel
+	case info.Rev == 1:
+		return store.ChangeAdd
+	}
+	return store.ChangeUpd
+}
+
+//push queues the change if it matches the filter
+//deletes without data always match
+func (w *mongoWatcher) push(c store.Change) {
+	if c.Data != nil {
+		if ok, err := w.filter.Match(c.Data); err != nil || !ok {
+			return
+		}
+	}
+	w.queue = append(w.queue, c)
+}
+
+func (w *mongoWatcher) Change() store.Change {
+	return w.change
+}
+
+func (w *mongoWatcher) Err() error {
+	return w.err
+}
+
+//Close stops the watch, also from another goroutine while Next() is waiting
+func (w *mongoWatcher) Close() error {
+	w.cancel()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.queue = nil
+	if w.stream == nil {
+		return nil
+	}
+	ctx, cancel := w.s.opContext(context.Background())
+	defer cancel()
+	err := w.stream.Close(ctx)
+	w.stream = nil
+	w.poll = nil
+	return err
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+
+	"github.com/go-msvc/errors"
+)
+
+//Sort fields that refer to the item info rather than the item data
+const (
+	SortByID        = "$id"
+	SortByTimestamp = "$ts"
+)
+
+//SortKey is a field to sort on, either a dotted path like in Filter
+//or one of the SortBy... item info fields
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+//Asc sorts on the field in ascending order
+func Asc(field string) SortKey {
+	return SortKey{Field: field}
+}
+
+//Desc sorts on the field in descending order
+func Desc(field string) SortKey {
+	return SortKey{Field: field, Desc: true}
+}
+
+//Query selects a page of items
+type Query struct {
+	//Filter selects the items, zero value for all
+	Filter Filter
+	//Sort order of items, which is always followed by the item id
+	//so that items with the same sort values are in a stable order
+	Sort []SortKey
+	//Limit is the max nr of items in the page, <=0 for all
+	Limit int
+	//Cursor is Page.Next from the previous page, or empty for the first page
+	Cursor string
+}
+
+//Page of items returned from a query
+type Page struct {
+	Items []interface{}
+	Info  []ItemInfo
+	//Next is the cursor to get the next page, empty when this is the last page
+	Next string
+}
+
+//SortKeys returns the sort keys of the query ending with the item id
+func (q Query) SortKeys() []SortKey {
+	keys := make([]SortKey, 0, len(q.Sort)+1)
+	for _, key := range q.Sort {
+		if key.Field == SortByID {
+			return append(keys, key)
+		}
+		keys = append(keys, key)
+	}
+	return append(keys, Asc(SortByID))
+}
+
+//Validate checks that the query can be applied to items of type t
+func (q Query) Validate(t reflect.Type) error {
+	if err := q.Filter.Validate(t); err != nil {
+		return err
+	}
+	for _, key := range q.Sort {
+		if _, err := sortFieldType(t, key.Field); err != nil {
+			return err
+		}
+	}
+	if len(q.Cursor) > 0 {
+		if _, err := q.DecodeCursor(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//sortFieldType returns the type of values of a sort field
+func sortFieldType(t reflect.Type, field string) (reflect.Type, error) {
+	switch field {
+	case SortByID:
+		return reflect.TypeOf(ID("")), nil
+	case SortByTimestamp:
+		return timeType, nil
+	}
+	fields, err := FieldByPath(t, field)
+	if err != nil {
+		return nil, err
+	}
+	ft := fields[len(fields)-1].Type
+	for _, f := range fields[:len(fields)-1] {
+		if f.Type.Kind() == reflect.Slice || f.Type.Kind() == reflect.Array {
+			return nil, errors.Errorf("cannot sort on \"%s\" inside a list", field)
+		}
+	}
+	if ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array || ft.Kind() == reflect.Map {
+		return nil, errors.Errorf("cannot sort on list \"%s\"", field)
+	}
+	return ft, nil
+} //sortFieldType()
+
+//SortValues returns the values of the sort keys of an item
+func (q Query) SortValues(v interface{}, info ItemInfo) []interface{} {
+	keys := q.SortKeys()
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = sortValue(v, info, key.Field)
+	}
+	return values
+}
+
+func sortValue(v interface{}, info ItemInfo, field string) interface{} {
+	switch field {
+	case SortByID:
+		return info.ID
+	case SortByTimestamp:
+		return info.Timestamp
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	fields, err := FieldByPath(rv.Type(), field)
+	if err != nil {
+		return nil
+	}
+	values := fieldValues(rv, fields)
+	if len(values) == 0 {
+		return nil
+	}
+	fv := values[0]
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	return fv.Interface()
+} //sortValue()
+
+//CompareSortValues compares the sort values of two items in the order of the query,
+//returning <0 if a is before b, 0 if the same and >0 if a is after b.
+//Nil values are before all other values.
+func (q Query) CompareSortValues(a, b []interface{}) int {
+	for i, key := range q.SortKeys() {
+		c := compareValues(a[i], b[i])
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	c, _ := compare(reflect.ValueOf(a), reflect.ValueOf(b))
+	return c
+}
+
+//cursor is encoded as base64 JSON with one value per sort key
+type cursor []json.RawMessage
+
+//EncodeCursor makes the opaque cursor after an item with the sort values
+func EncodeCursor(values []interface{}) string {
+	c := make(cursor, len(values))
+	for i, v := range values {
+		c[i], _ = json.Marshal(v)
+	}
+	jsonCursor, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(jsonCursor)
+}
+
+//DecodeCursor returns the sort values in q.Cursor for items of type t
+func (q Query) DecodeCursor(t reflect.Type) ([]interface{}, error) {
+	jsonCursor, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid cursor")
+	}
+	c := cursor{}
+	if err := json.Unmarshal(jsonCursor, &c); err != nil {
+		return nil, errors.Wrapf(err, "invalid cursor")
+	}
+	keys := q.SortKeys()
+	if len(c) != len(keys) {
+		return nil, errors.Errorf("cursor has %d values for %d sort keys", len(c), len(keys))
+	}
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		ft, err := sortFieldType(t, key.Field)
+		if err != nil {
+			return nil, err
+		}
+		if string(c[i]) == "null" {
+			continue
+		}
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		pv := reflect.New(ft)
+		if err := json.Unmarshal(c[i], pv.Interface()); err != nil {
+			return nil, errors.Wrapf(err, "invalid cursor value for %s", key.Field)
+		}
+		values[i] = pv.Elem().Interface()
+	}
+	return values, nil
+} //Query.DecodeCursor()
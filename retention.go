@@ -0,0 +1,52 @@
+package store
+
+import (
+	"time"
+)
+
+//Retention limits the older revisions that a store keeps of each item.
+//The latest revision is always kept and a revision is only kept when
+//all of the limits allow it. The zero value keeps all revisions.
+type Retention struct {
+	//MaxRevs is the max nr of revisions kept, including the latest, 0 for unlimited
+	MaxRevs int
+	//MaxAge is how long older revisions are kept after they were created, 0 for unlimited
+	MaxAge time.Duration
+	//Daily squashes older revisions to keep only the last revision of each day (UTC)
+	Daily bool
+}
+
+//IsZero is true when all revisions are kept
+func (r Retention) IsZero() bool {
+	return r.MaxRevs <= 0 && r.MaxAge <= 0 && !r.Daily
+}
+
+//Keep returns for each revision whether to keep it, where revs are the
+//revisions of one item in ascending rev order, ending with the latest
+func (r Retention) Keep(revs []ItemInfo, now time.Time) []bool {
+	keep := make([]bool, len(revs))
+	last := len(revs) - 1
+	for i := range revs {
+		if i == last {
+			keep[i] = true
+			break
+		}
+		keep[i] = true
+		if r.MaxRevs > 0 && last-i >= r.MaxRevs {
+			keep[i] = false
+		}
+		if r.MaxAge > 0 && now.Sub(revs[i].Timestamp) > r.MaxAge {
+			keep[i] = false
+		}
+		if r.Daily && sameDay(revs[i].Timestamp, revs[i+1].Timestamp) {
+			keep[i] = false
+		}
+	}
+	return keep
+} //Retention.Keep()
+
+func sameDay(t1, t2 time.Time) bool {
+	y1, m1, d1 := t1.UTC().Date()
+	y2, m2, d2 := t2.UTC().Date()
+	return y1 == y2 && m1 == m2 && d1 == d2
+}
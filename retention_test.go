@@ -0,0 +1,41 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionKeep(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	revs := []ItemInfo{
+		{Rev: 1, Timestamp: now.Add(-50 * time.Hour)},
+		{Rev: 2, Timestamp: now.Add(-49 * time.Hour)},
+		{Rev: 3, Timestamp: now.Add(-25 * time.Hour)},
+		{Rev: 4, Timestamp: now.Add(-2 * time.Hour)},
+		{Rev: 5, Timestamp: now.Add(-1 * time.Hour)},
+	}
+	tests := []struct {
+		retention Retention
+		keep      string
+	}{
+		{Retention{}, "11111"},
+		{Retention{MaxRevs: 2}, "00011"},
+		{Retention{MaxRevs: 1}, "00001"},
+		{Retention{MaxAge: 24 * time.Hour}, "00011"},
+		{Retention{Daily: true}, "01101"},
+		{Retention{Daily: true, MaxRevs: 3}, "00101"},
+	}
+	for _, test := range tests {
+		keep := ""
+		for _, k := range test.retention.Keep(revs, now) {
+			if k {
+				keep += "1"
+			} else {
+				keep += "0"
+			}
+		}
+		if keep != test.keep {
+			t.Fatalf("%+v kept %s instead of %s", test.retention, keep, test.keep)
+		}
+	}
+}
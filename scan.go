@@ -0,0 +1,33 @@
+package store
+
+//IIterator returns items one at a time from Scan(), e.g.
+//	it, err := s.Scan(filter)
+//	if err != nil {...}
+//	defer it.Close()
+//	for it.Next() {
+//		v, info := it.Item()
+//		...
+//	}
+//	if err := it.Err(); err != nil {...}
+type IIterator interface {
+	//Next moves to the next item and is false when there are no more items or on error
+	Next() bool
+	//Item returns the current item
+	Item() (v interface{}, info ItemInfo)
+	//Err returns the error that stopped Next(), if any
+	Err() error
+	//Close releases the iterator, which may be called before all items were read
+	Close() error
+}
+
+//ForEach calls fn for each item from the iterator until fn returns an error,
+//then closes the iterator and returns the first error from fn or the iterator
+func ForEach(it IIterator, fn func(v interface{}, info ItemInfo) error) error {
+	defer it.Close()
+	for it.Next() {
+		if err := fn(it.Item()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,78 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-msvc/store"
+	"github.com/go-msvc/store/memory"
+)
+
+type UserProfile struct {
+	Name string
+}
+
+func TestNew(t *testing.T) {
+	s, err := store.New(UserProfile{})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if s.Name() != "user_profile" {
+		t.Fatalf("name=\"%s\"", s.Name())
+	}
+
+	s, err = store.New(&UserProfile{}, store.WithBackend("memory"), store.WithItemName("profile"))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if s.Name() != "profile" || s.Type().Name() != "UserProfile" {
+		t.Fatalf("name=\"%s\", type=%v", s.Name(), s.Type())
+	}
+
+	var storeErr *store.Error
+	if _, err := store.New(UserProfile{}, store.WithBackend("nonexisting")); !errors.Is(err, store.ErrInvalidValue) || !errors.As(err, &storeErr) || storeErr.Op != "New" {
+		t.Fatalf("created store with unknown backend: %v", err)
+	}
+	if _, err := store.New(1); err == nil {
+		t.Fatalf("created store for int")
+	}
+	if _, err := store.New(UserProfile{}, store.WithConfig(memory.Config{})); err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	s, err := store.Open("memory://", UserProfile{})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if s.Name() != "user_profile" {
+		t.Fatalf("name=\"%s\"", s.Name())
+	}
+	for _, rawURL := range []string{
+		"memory://localhost/db", //memory has no host and path
+		"unknown://localhost/db",
+		"localhost/db",
+		"memory://%zz",
+	} {
+		var storeErr *store.Error
+		if _, err := store.Open(rawURL, UserProfile{}); !errors.Is(err, store.ErrInvalidValue) || !errors.As(err, &storeErr) || storeErr.Op != "Open" {
+			t.Fatalf("opened \"%s\": %v", rawURL, err)
+		}
+	}
+}
+
+func TestNewTypedStore(t *testing.T) {
+	s, err := store.NewTypedStore[UserProfile](store.WithBackend("memory"))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	info, err := s.Add(UserProfile{Name: "a"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	u, _, err := s.Get(info.ID)
+	if err != nil || u.Name != "a" {
+		t.Fatalf("got %+v, err=%v", u, err)
+	}
+}
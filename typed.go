@@ -0,0 +1,259 @@
+package store
+
+import (
+	"reflect"
+
+	"github.com/go-msvc/errors"
+)
+
+//Typed wraps an IStore for items of type T so that callers
+//pass and get T instead of interface{} and need no type assertions.
+//T is checked against IStore.Type() once when the wrapper is created.
+type Typed[T any] struct {
+	s IStore
+}
+
+//NewTyped wraps s which must store items of type T
+func NewTyped[T any](s IStore) (*Typed[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if s.Type() != t {
+		return nil, &Error{Store: s.Name(), Op: "NewTyped", Err: ErrInvalidType, Cause: errors.Errorf("store type %v != %v", s.Type(), t)}
+	}
+	return &Typed[T]{s: s}, nil
+}
+
+//MustNewTyped ...
+func MustNewTyped[T any](s IStore) *Typed[T] {
+	ts, err := NewTyped[T](s)
+	if err != nil {
+		panic(err)
+	}
+	return ts
+}
+
+//NewTypedStore creates a store for items of type T with New()
+func NewTypedStore[T any](opts ...Option) (*Typed[T], error) {
+	var tmpl T
+	s, err := New(tmpl, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewTyped[T](s)
+}
+
+//Store returns the wrapped store
+func (ts Typed[T]) Store() IStore {
+	return ts.s
+}
+
+//Name ...
+func (ts Typed[T]) Name() string {
+	return ts.s.Name()
+}
+
+//Add ...
+func (ts Typed[T]) Add(v T) (ItemInfo, error) {
+	return ts.s.Add(v)
+}
+
+//Get ...
+func (ts Typed[T]) Get(id ID) (T, ItemInfo, error) {
+	v, info, err := ts.s.Get(id)
+	if err != nil {
+		var t T
+		return t, info, err
+	}
+	t, err := ts.item(v)
+	return t, info, err
+}
+
+//GetInfo ...
+func (ts Typed[T]) GetInfo(id ID) (ItemInfo, error) {
+	return ts.s.GetInfo(id)
+}
+
+//GetBy ...
+func (ts Typed[T]) GetBy(max int, key map[string]interface{}) ([]T, []ItemInfo, error) {
+	values, info, err := ts.s.GetBy(max, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := ts.items(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, info, nil
+}
+
+//Find ...
+func (ts Typed[T]) Find(max int, filter Filter) ([]T, []ItemInfo, error) {
+	values, info, err := ts.s.Find(max, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := ts.items(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, info, nil
+}
+
+//Query returns a page of items and the cursor for the next page
+func (ts Typed[T]) Query(q Query) ([]T, []ItemInfo, string, error) {
+	page, err := ts.s.Query(q)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	items, err := ts.items(page.Items)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return items, page.Info, page.Next, nil
+}
+
+//ForEach calls fn for the latest revision of each item that matches the filter
+//until fn returns an error
+func (ts Typed[T]) ForEach(filter Filter, fn func(v T, info ItemInfo) error) error {
+	it, err := ts.s.Scan(filter)
+	if err != nil {
+		return err
+	}
+	return ForEach(it, func(v interface{}, info ItemInfo) error {
+		t, err := ts.item(v)
+		if err != nil {
+			return err
+		}
+		return fn(t, info)
+	})
+}
+
+//Count ...
+func (ts Typed[T]) Count(filter Filter) (int, error) {
+	return ts.s.Count(filter)
+}
+
+//Exists ...
+func (ts Typed[T]) Exists(id ID) (bool, error) {
+	return ts.s.Exists(id)
+}
+
+//Upd ...
+func (ts Typed[T]) Upd(id ID, v T) (ItemInfo, error) {
+	return ts.s.Upd(id, v)
+}
+
+//UpdIf ...
+func (ts Typed[T]) UpdIf(id ID, expectedRev int, v T) (ItemInfo, error) {
+	return ts.s.UpdIf(id, expectedRev, v)
+}
+
+//AddMany ...
+func (ts Typed[T]) AddMany(values []T) ([]ItemInfo, error) {
+	return ts.s.AddMany(ts.values(values))
+}
+
+//GetMany returns the items, with zero values for items that failed
+func (ts Typed[T]) GetMany(ids []ID) ([]T, []ItemInfo, error) {
+	values, info, err := ts.s.GetMany(ids)
+	if len(values) != len(ids) {
+		return nil, nil, err
+	}
+	errs := BatchErrors(err, len(ids))
+	items := make([]T, len(values))
+	for i, v := range values {
+		if errs[i] == nil {
+			items[i], errs[i] = ts.item(v)
+		}
+	}
+	return items, info, NewBatchError(errs)
+}
+
+//UpdMany ...
+func (ts Typed[T]) UpdMany(ids []ID, values []T) ([]ItemInfo, error) {
+	return ts.s.UpdMany(ids, ts.values(values))
+}
+
+//DelMany ...
+func (ts Typed[T]) DelMany(ids []ID) error {
+	return ts.s.DelMany(ids)
+}
+
+//GetRev ...
+func (ts Typed[T]) GetRev(id ID, rev int) (T, ItemInfo, error) {
+	v, info, err := ts.s.GetRev(id, rev)
+	if err != nil {
+		var t T
+		return t, info, err
+	}
+	t, err := ts.item(v)
+	return t, info, err
+}
+
+//ListRevs ...
+func (ts Typed[T]) ListRevs(id ID) ([]ItemInfo, error) {
+	return ts.s.ListRevs(id)
+}
+
+//GetHistory ...
+func (ts Typed[T]) GetHistory(id ID) ([]T, []ItemInfo, error) {
+	values, info, err := ts.s.GetHistory(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := ts.items(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, info, nil
+}
+
+//Del ...
+func (ts Typed[T]) Del(id ID) error {
+	return ts.s.Del(id)
+}
+
+//Undelete ...
+func (ts Typed[T]) Undelete(id ID) (ItemInfo, error) {
+	return ts.s.Undelete(id)
+}
+
+//Purge ...
+func (ts Typed[T]) Purge(id ID) error {
+	return ts.s.Purge(id)
+}
+
+//item converts a value from the store to T
+func (ts Typed[T]) item(v interface{}) (T, error) {
+	switch t := v.(type) {
+	case T:
+		return t, nil
+	case *T:
+		if t != nil {
+			return *t, nil
+		}
+	}
+	var t T
+	return t, &Error{Store: ts.s.Name(), Op: "Get", Err: ErrInvalidType, Cause: errors.Errorf("got %T instead of %T", v, t)}
+}
+
+//values converts a list of T to values for the store
+func (ts Typed[T]) values(items []T) []interface{} {
+	values := make([]interface{}, len(items))
+	for i, t := range items {
+		values[i] = t
+	}
+	return values
+}
+
+//items converts a list of values from the store to []T
+func (ts Typed[T]) items(values []interface{}) ([]T, error) {
+	items := make([]T, len(values))
+	for i, v := range values {
+		t, err := ts.item(v)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = t
+	}
+	return items, nil
+}
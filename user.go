@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+)
+
+type userKey struct{}
+
+//WithUser returns a context for operations on behalf of the user,
+//which backends record in ItemInfo.UserID of each revision they write
+func WithUser(ctx context.Context, userID ID) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+//UserFromContext returns the user set with WithUser(), or "" if none
+func UserFromContext(ctx context.Context) ID {
+	userID, _ := ctx.Value(userKey{}).(ID)
+	return userID
+}
+
+//AsUser returns the store for writes on behalf of the user, for callers
+//that use IStore rather than passing WithUser() to the IContextStore
+func AsUser(s IStore, userID ID) IStore {
+	return adapter{s: s.ContextStore(), user: userID}
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-msvc/errors"
+)
+
+//IValidator is implemented by item types that validate their own data,
+//which is done after the struct tag rules
+type IValidator interface {
+	Validate() error
+}
+
+//FieldError describes one failed validation rule
+type FieldError struct {
+	//Field is the path of the field, e.g. "Home.City" or "Friends[1].Name",
+	//or empty when the item's Validate() method failed
+	Field string
+	//Rule is "required", "min", "max", "regex" or "Validate"
+	Rule string
+	Msg  string
+}
+
+func (e FieldError) String() string {
+	if len(e.Field) == 0 {
+		return e.Msg
+	}
+	return e.Field + ": " + e.Msg
+}
+
+//ValidationError is the Err in an Error from Add() and Upd() when the value
+//is not valid, listing each failed rule. It matches ErrInvalidValue.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.String()
+	}
+	return "invalid value: " + strings.Join(msgs, "; ")
+}
+
+//Is makes errors.Is(err, ErrInvalidValue) true
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidValue
+}
+
+//CheckValue is called by backends before writing a value to a store of
+//type t. It accepts a value of type t or a non-nil pointer to it, and returns
+//the value of type t after checking it with ValidateValue(). Other values
+//fail with TypeError.
+func CheckValue(t reflect.Type, v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Type() != t && rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.Type() != t {
+		return nil, TypeError{Type: reflect.TypeOf(v), Expected: t}
+	}
+	v = rv.Interface()
+	if err := ValidateValue(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+} //CheckValue()
+
+//ValidateValue checks the value against the rules in the "store" tags of
+//its fields, including nested structs and lists of structs, then calls its
+//Validate() method if it implements IValidator. Rules are:
+//	required    the field must not be the zero value, nil or empty
+//	min=<n>     numbers must be >=n and strings, lists and maps must have len>=n
+//	max=<n>     numbers must be <=n and strings, lists and maps must have len<=n
+//	regex=<re>  strings must match, which must be the last rule in the tag
+//Rules on nil pointers other than required are not applied.
+//Returns nil or a *ValidationError.
+func ValidateValue(v interface{}) error {
+	e := &ValidationError{}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		if err := validateStruct(e, "", rv); err != nil {
+			e.Fields = append(e.Fields, FieldError{Rule: "store tag", Msg: err.Error()})
+		}
+	}
+	validator, ok := v.(IValidator)
+	if !ok && rv.Kind() == reflect.Struct {
+		//also call Validate() with a pointer receiver
+		pv := reflect.New(rv.Type())
+		pv.Elem().Set(rv)
+		validator, ok = pv.Interface().(IValidator)
+	}
+	if ok {
+		if err := validator.Validate(); err != nil {
+			if verr, ok := err.(*ValidationError); ok {
+				e.Fields = append(e.Fields, verr.Fields...)
+			} else {
+				e.Fields = append(e.Fields, FieldError{Rule: "Validate", Msg: err.Error()})
+			}
+		}
+	}
+	if len(e.Fields) > 0 {
+		return e
+	}
+	return nil
+} //ValidateValue()
+
+//validateStruct adds the failed rules of the struct value to e
+//and only returns an error if the rules in the tags are invalid
+func validateStruct(e *ValidationError, prefix string, v reflect.Value) error {
+	rules, err := structRules(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		fv := v.Field(r.index)
+		path := prefix + r.name
+		r.check(e, path, fv)
+
+		//nested structs
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		switch {
+		case fv.Kind() == reflect.Struct && fv.Type() != timeType:
+			if err := validateStruct(e, path+".", fv); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array:
+			for i := 0; i < fv.Len(); i++ {
+				ev := fv.Index(i)
+				for ev.Kind() == reflect.Ptr && !ev.IsNil() {
+					ev = ev.Elem()
+				}
+				if ev.Kind() == reflect.Struct && ev.Type() != timeType {
+					if err := validateStruct(e, fmt.Sprintf("%s[%d].", path, i), ev); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+} //validateStruct()
+
+//fieldRules are the rules in the "store" tag of one struct field
+type fieldRules struct {
+	index    int
+	name     string
+	required bool
+	min, max *float64
+	regex    *regexp.Regexp
+}
+
+//check adds the failed rules of the field value to e
+func (r fieldRules) check(e *ValidationError, path string, v reflect.Value) {
+	if r.required && (!v.IsValid() || v.IsZero() || ((v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0)) {
+		e.Fields = append(e.Fields, FieldError{Field: path, Rule: "required", Msg: "required"})
+		return
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	var n float64
+	var what string
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, what = float64(v.Int()), "value"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, what = float64(v.Uint()), "value"
+	case reflect.Float32, reflect.Float64:
+		n, what = v.Float(), "value"
+	case reflect.String:
+		n, what = float64(len([]rune(v.String()))), "length"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, what = float64(v.Len()), "length"
+	}
+	if len(what) > 0 && r.min != nil && n < *r.min {
+		e.Fields = append(e.Fields, FieldError{Field: path, Rule: "min", Msg: fmt.Sprintf("%s %v < min %v", what, n, *r.min)})
+	}
+	if len(what) > 0 && r.max != nil && n > *r.max {
+		e.Fields = append(e.Fields, FieldError{Field: path, Rule: "max", Msg: fmt.Sprintf("%s %v > max %v", what, n, *r.max)})
+	}
+	if r.regex != nil && v.Kind() == reflect.String && !r.regex.MatchString(v.String()) {
+		e.Fields = append(e.Fields, FieldError{Field: path, Rule: "regex", Msg: fmt.Sprintf("\"%s\" does not match %s", v.String(), r.regex)})
+	}
+} //fieldRules.check()
+
+var rulesByType sync.Map //reflect.Type -> []fieldRules
+
+//structRules returns the rules of each exported field of a struct type
+func structRules(t reflect.Type) ([]fieldRules, error) {
+	if rules, ok := rulesByType.Load(t); ok {
+		return rules.([]fieldRules), nil
+	}
+	rules := make([]fieldRules, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		r, err := parseRules(f.Tag.Get("store"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid store tag on %v.%s", t, f.Name)
+		}
+		r.index = i
+		r.name = f.Name
+		rules = append(rules, r)
+	}
+	rulesByType.Store(t, rules)
+	return rules, nil
+} //structRules()
+
+//parseRules parses the options in a "store" tag, ignoring options that
+//are not validation rules
+func parseRules(tag string) (fieldRules, error) {
+	r := fieldRules{}
+	for _, opt := range tagOptions(tag) {
+		name, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			name, value = opt[:i], opt[i+1:]
+		}
+		switch name {
+		case "required":
+			r.required = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return r, errors.Wrapf(err, "invalid %s=%s", name, value)
+			}
+			if name == "min" {
+				r.min = &n
+			} else {
+				r.max = &n
+			}
+		case "regex":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return r, errors.Wrapf(err, "invalid regex")
+			}
+			r.regex = re
+		}
+	}
+	return r, nil
+} //parseRules()
+
+//tagOptions splits a "store" tag into its comma separated options,
+//where "regex=..." is the last option and may contain commas
+func tagOptions(tag string) []string {
+	opts := []string{}
+	for len(tag) > 0 {
+		if strings.HasPrefix(tag, "regex=") {
+			return append(opts, tag)
+		}
+		i := strings.Index(tag, ",")
+		if i < 0 {
+			return append(opts, tag)
+		}
+		opts = append(opts, tag[:i])
+		tag = tag[i+1:]
+	}
+	return opts
+}
+
+//validateTags checks that the rules in the "store" tags of the struct type
+//and nested struct types can be parsed
+func validateTags(t reflect.Type, visited map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || visited[t] {
+		return nil
+	}
+	visited[t] = true
+	if _, err := structRules(t); err != nil {
+		return err
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); len(f.PkgPath) == 0 {
+			if err := validateTags(f.Type, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+} //validateTags()
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type member struct {
+	Name  string   `store:"required"`
+	Email *string  `store:"regex=^[^@,]+@[^@]+$"`
+	Tags  []string `store:"min=1,max=2"`
+}
+
+type team struct {
+	Name    string `bson:"name" store:"index,required"`
+	Lead    *member
+	Members []member `store:"max=3"`
+}
+
+func TestValidateValue(t *testing.T) {
+	if err := ValidateUserType(reflect.TypeOf(team{})); err != nil {
+		t.Fatalf("valid type failed: %+v", err)
+	}
+	email := "a@b.c"
+	badEmail := "a,b"
+	tests := []struct {
+		value  interface{}
+		errors string
+	}{
+		{team{Name: "t", Members: []member{}}, ""},
+		{&team{Name: "t", Lead: &member{Name: "a", Email: &email, Tags: []string{"x"}}}, ""},
+		{team{}, "Name:required"},
+		{team{Name: "t", Lead: &member{Email: &badEmail, Tags: []string{}}}, "Lead.Name:required,Lead.Email:regex,Lead.Tags:min"},
+		{team{Name: "t", Members: []member{{Name: "a", Tags: []string{"x"}}, {Name: "b", Tags: []string{"1", "2", "3"}}}}, "Members[1].Tags:max"},
+	}
+	for i, test := range tests {
+		failed := []string{}
+		if err := ValidateValue(test.value); err != nil {
+			for _, f := range err.(*ValidationError).Fields {
+				failed = append(failed, f.Field+":"+f.Rule)
+			}
+		}
+		if strings.Join(failed, ",") != test.errors {
+			t.Fatalf("test[%d] failed %v instead of %s", i, failed, test.errors)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package store
+
+//ChangeOp is the kind of change in a Change
+type ChangeOp string
+
+//Change operations
+const (
+	//ChangeAdd when an item was added
+	ChangeAdd ChangeOp = "add"
+	//ChangeUpd when a new revision was written, also by Undelete()
+	ChangeUpd ChangeOp = "upd"
+	//ChangeDel when an item was deleted, soft or hard
+	ChangeDel ChangeOp = "del"
+)
+
+//Change describes one write to a store
+type Change struct {
+	Op ChangeOp
+	//Info of the new revision, which for soft deletes is the tombstone revision.
+	//For hard deletes, no revision is written, so Info has the ID and Rev of the
+	//last stored revision, with Deleted=true and the Timestamp and UserID of the delete.
+	Info ItemInfo
+	//Data of the new revision, or for deletes the last data if known, else nil
+	Data interface{}
+	//Old data of the previous revision when the backend knows it, else nil
+	Old interface{}
+	//Token is passed to Watch() to resume after this change
+	Token string
+}
+
+//IWatcher iterates over changes as they happen:
+//
+//	w, err := s.Watch(filter, "")
+//	...
+//	defer w.Close()
+//	for w.Next() {
+//		c := w.Change()
+//		...
+//	}
+//	if err := w.Err(); err != nil {
+//		...
+//	}
+type IWatcher interface {
+	//Next waits for the next change and returns false when the watch stopped,
+	//after which Err() tells why, or nil if stopped by Close()
+	Next() bool
+	//Change returns the change after Next() returned true
+	Change() Change
+	//Err returns the error that stopped the watch
+	Err() error
+	//Close stops the watch and may be called from another goroutine to end a blocked Next()
+	Close() error
+}